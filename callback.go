@@ -0,0 +1,72 @@
+package pkg_login
+
+import (
+	"net/http"
+	"net/url"
+)
+
+// callbackCodeParams 各服务商回调中授权码的参数名：钉钉为authCode，支付宝为auth_code，其他服务商为code
+var callbackCodeParams = []string{"code", "authCode", "auth_code"}
+
+// Callback 授权回调参数
+type Callback struct {
+	Code  string
+	State string
+}
+
+// ParseCallback 解析授权回调请求，支持query及form_post方式回调；不区分服务商，已知服务商时使用【Server.ParseCallback】
+func ParseCallback(r *http.Request) (*Callback, error) {
+	values, err := callbackValues(r)
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseCallbackValues(values)
+}
+
+// ParseCallback 按服务商的回调格式解析授权回调请求，如微信用户拒绝授权时只回调state，错误已包装为【ProviderError】
+func (s *Server) ParseCallback(r *http.Request) (*Callback, error) {
+	values, err := callbackValues(r)
+	if err != nil {
+		return nil, s.wrapError(StageAuthorize, err)
+	}
+
+	var callback *Callback
+	if parser, ok := s.client.(CallbackParser); ok {
+		callback, err = parser.ParseCallback(values)
+	} else {
+		callback, err = ParseCallbackValues(values)
+	}
+	if err != nil {
+		return nil, s.wrapError(StageAuthorize, err)
+	}
+
+	return callback, nil
+}
+
+func callbackValues(r *http.Request) (url.Values, error) {
+	if err := r.ParseForm(); err != nil {
+		return nil, &ProviderError{Description: "回调参数解析失败", Kind: ErrInvalidResponse, Err: err}
+	}
+
+	return r.Form, nil
+}
+
+// ParseCallbackValues 解析授权回调参数；用户拒绝授权等情况下服务商回调携带error而非code，
+// 此时返回【ProviderError】，用户拒绝授权可使用errors.Is(err, ErrAccessDenied)判断
+func ParseCallbackValues(values url.Values) (*Callback, error) {
+	if errCode := values.Get("error"); len(errCode) > 0 {
+		providerErr := newProviderError(0, errCode, values.Get("error_description"))
+		providerErr.Kind = classifyProviderError("", StageAuthorize, providerErr)
+		return nil, providerErr
+	}
+
+	callback := &Callback{State: values.Get("state")}
+	for _, param := range callbackCodeParams {
+		if callback.Code = values.Get(param); len(callback.Code) > 0 {
+			return callback, nil
+		}
+	}
+
+	return nil, &ProviderError{Description: "回调缺失code", Kind: ErrInvalidGrant}
+}
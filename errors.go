@@ -0,0 +1,203 @@
+package pkg_login
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+)
+
+// 错误分类，使用errors.Is判断；服务商返回的错误码及描述使用errors.As获取【ProviderError】
+var (
+	ErrNotConfigured       = errors.New("配置缺失或错误")
+	ErrUnknownProvider     = errors.New("未定义实现")
+	ErrNotSupported        = errors.New("服务商不支持该操作")
+	ErrInvalidState        = errors.New("state无效、已过期或已被使用")
+	ErrInvalidGrant        = errors.New("授权码或refresh_token无效、已过期或已被使用")
+	ErrAccessDenied        = errors.New("用户拒绝授权")
+	ErrInvalidClient       = errors.New("应用凭证无效")
+	ErrInvalidToken        = errors.New("access_token无效或已过期")
+	ErrInvalidIDToken      = errors.New("id_token校验失败")
+	ErrEmailNotVerified    = errors.New("邮箱未验证")
+	ErrInvalidResponse     = errors.New("服务商响应格式错误")
+	ErrProviderUnavailable = errors.New("服务商暂不可用")
+)
+
+// 出错阶段
+const (
+	StageAuthorize = "authorize" // 生成授权地址
+	StageExchange  = "exchange"  // code换取token
+	StageRefresh   = "refresh"   // 刷新token
+	StageUserinfo  = "userinfo"  // 获取账户信息
+	StageRevoke    = "revoke"    // 撤销授权
+	StageVerify    = "verify"    // 校验id_token
+)
+
+// ProviderError 服务商调用错误，Provider、Stage由【Server】填充
+type ProviderError struct {
+	Provider    string // 服务商注册名
+	Stage       string // 出错阶段，见Stage*常量
+	HTTPStatus  int    // 服务商响应状态码，请求未完成或未知时为0
+	Code        string // 服务商错误码
+	Description string // 服务商错误描述
+	Kind        error  // 错误分类，如【ErrInvalidGrant】，无法分类时为nil
+	Err         error  // 底层错误，如网络错误、响应解析错误
+}
+
+func (e *ProviderError) Error() string {
+	var detail string
+	var inner *ProviderError
+	switch {
+	case errors.As(e.Err, &inner):
+		// 底层错误已包含服务商错误信息及调用方补充的上下文，如"openid获取失败:"
+		detail = e.Err.Error()
+	case len(e.Code) > 0 && len(e.Description) > 0:
+		detail = e.Code + ":" + e.Description
+	case len(e.Code) > 0:
+		detail = e.Code
+	case len(e.Description) > 0:
+		detail = e.Description
+	case e.Err != nil:
+		detail = e.Err.Error()
+	case e.Kind != nil:
+		detail = e.Kind.Error()
+	default:
+		detail = "http " + strconv.Itoa(e.HTTPStatus)
+	}
+
+	switch {
+	case len(e.Provider) > 0 && len(e.Stage) > 0:
+		return e.Provider + " " + e.Stage + ": " + detail
+	case len(e.Provider) > 0:
+		return e.Provider + ": " + detail
+	}
+
+	return detail
+}
+
+func (e *ProviderError) Unwrap() []error {
+	errs := make([]error, 0, 2)
+	if e.Kind != nil {
+		errs = append(errs, e.Kind)
+	}
+	if e.Err != nil {
+		errs = append(errs, e.Err)
+	}
+
+	return errs
+}
+
+// newProviderError 服务商返回的业务错误，分类由【Server】按阶段补充
+func newProviderError(httpStatus int, code, description string) *ProviderError {
+	return &ProviderError{HTTPStatus: httpStatus, Code: code, Description: description}
+}
+
+// invalidResponse 服务商响应缺失必要字段或校验失败
+func invalidResponse(description string) *ProviderError {
+	return &ProviderError{Description: description, Kind: ErrInvalidResponse}
+}
+
+// oauth2ErrorKinds RFC 6749标准错误码分类，所有服务商通用
+var oauth2ErrorKinds = map[string]error{
+	"invalid_grant":           ErrInvalidGrant,
+	"invalid_client":          ErrInvalidClient,
+	"unauthorized_client":     ErrInvalidClient,
+	"access_denied":           ErrAccessDenied,
+	"invalid_token":           ErrInvalidToken,
+	"expired_token":           ErrInvalidToken,
+	"server_error":            ErrProviderUnavailable,
+	"temporarily_unavailable": ErrProviderUnavailable,
+}
+
+// weiXinErrorKinds 微信开放平台及公众号共用的错误码分类
+var weiXinErrorKinds = map[string]error{
+	"-1":    ErrProviderUnavailable,
+	"40029": ErrInvalidGrant, // code无效
+	"40163": ErrInvalidGrant, // code已被使用
+	"40013": ErrInvalidClient,
+	"40125": ErrInvalidClient,
+	"40014": ErrInvalidToken,
+	"42001": ErrInvalidToken,
+}
+
+// providerErrorKinds 各服务商私有错误码分类，key为服务商注册名；数字错误码在不同服务商含义不同，不能混用
+var providerErrorKinds = map[string]map[string]error{
+	ProviderGithub: {
+		"bad_verification_code":        ErrInvalidGrant,
+		"incorrect_client_credentials": ErrInvalidClient,
+	},
+	ProviderWeiXin:   weiXinErrorKinds,
+	ProviderWeiXinMp: weiXinErrorKinds,
+	ProviderQq: {
+		"100008": ErrInvalidClient,
+		"100009": ErrInvalidClient,
+		"100013": ErrInvalidToken,
+		"100014": ErrInvalidToken,
+		"100015": ErrInvalidToken,
+		"100016": ErrInvalidToken,
+		"100019": ErrInvalidGrant,
+		"100020": ErrInvalidGrant,
+	},
+	ProviderWeiBo: {
+		"21324": ErrInvalidClient,
+		"21325": ErrInvalidGrant,
+		"21327": ErrInvalidToken,
+		"21332": ErrInvalidToken,
+	},
+	ProviderAlipay: {
+		"20000":                   ErrProviderUnavailable,
+		"isv.code-invalid":        ErrInvalidGrant,
+		"isv.invalid-app-id":      ErrInvalidClient,
+		"isv.invalid-signature":   ErrInvalidClient,
+		"invalid-auth-token":      ErrInvalidToken,
+		"auth-token-time-out":     ErrInvalidToken,
+		"isv.invalid-auth-token":  ErrInvalidToken,
+		"isv.auth-token-time-out": ErrInvalidToken,
+	},
+}
+
+// classifyProviderError 优先按服务商私有错误码及标准错误码分类，无法识别时按状态码分类；provider为空时只识别标准错误码
+func classifyProviderError(provider, stage string, e *ProviderError) error {
+	// 微博等服务商错误码为数字，标准错误名放在描述中
+	for _, code := range []string{e.Code, e.Description} {
+		if kind, ok := providerErrorKinds[provider][code]; ok {
+			return kind
+		}
+		if kind, ok := oauth2ErrorKinds[code]; ok {
+			return kind
+		}
+	}
+
+	switch {
+	case e.HTTPStatus >= 500 || e.HTTPStatus == 429:
+		return ErrProviderUnavailable
+	case e.HTTPStatus == 401 && stage == StageUserinfo:
+		return ErrInvalidToken
+	case e.HTTPStatus == 401:
+		return ErrInvalidClient
+	}
+
+	return nil
+}
+
+// classifyCause 非服务商业务错误的分类，网络错误为【ErrProviderUnavailable】，解析失败为【ErrInvalidResponse】
+func classifyCause(err error) error {
+	var (
+		netErr       net.Error
+		syntaxErr    *json.SyntaxError
+		unmarshalErr *json.UnmarshalTypeError
+	)
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return nil
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr):
+		return ErrProviderUnavailable
+	case errors.As(err, &syntaxErr), errors.As(err, &unmarshalErr), errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return ErrInvalidResponse
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package pkg_login
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestClassifyProviderError(t *testing.T) {
+	tests := []struct {
+		name     string
+		provider string
+		err      *ProviderError
+		want     error
+	}{
+		{name: "标准错误码", provider: ProviderGitee, err: newProviderError(http.StatusBadRequest, "invalid_grant", ""), want: ErrInvalidGrant},
+		{name: "标准错误码不区分服务商", err: newProviderError(0, "access_denied", ""), want: ErrAccessDenied},
+		{name: "微信私有错误码", provider: ProviderWeiXin, err: newProviderError(0, "40029", "invalid code"), want: ErrInvalidGrant},
+		{name: "微信公众号私有错误码", provider: ProviderWeiXinMp, err: newProviderError(0, "42001", ""), want: ErrInvalidToken},
+		{name: "其他服务商不使用微信错误码", provider: ProviderQq, err: newProviderError(0, "40029", ""), want: nil},
+		{name: "其他服务商不使用支付宝错误码", provider: ProviderWeiBo, err: newProviderError(0, "20000", ""), want: nil},
+		{name: "QQ私有错误码", provider: ProviderQq, err: newProviderError(0, "100019", ""), want: ErrInvalidGrant},
+		{name: "微博标准错误名在描述中", provider: ProviderWeiBo, err: newProviderError(http.StatusBadRequest, "21327", "expired_token"), want: ErrInvalidToken},
+		{name: "未识别时按状态码分类", provider: ProviderFeiShu, err: newProviderError(http.StatusBadGateway, "", ""), want: ErrProviderUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := classifyProviderError(tt.provider, StageExchange, tt.err); got != tt.want {
+				t.Fatalf("期望%v，实际: %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestServerWrapError(t *testing.T) {
+	server := &Server{Provider: ProviderQq}
+	inner := newProviderError(0, "100016", "access token check failed")
+
+	err := server.wrapError(StageUserinfo, fmt.Errorf("openid获取失败:%w", inner))
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		t.Fatalf("期望ProviderError，实际: %v", err)
+	}
+	if providerErr.Provider != ProviderQq || providerErr.Stage != StageUserinfo || providerErr.Code != "100016" || !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("包装结果错误: %+v", providerErr)
+	}
+	if !strings.Contains(err.Error(), "openid获取失败:") {
+		t.Fatalf("应保留外层上下文，实际: %s", err)
+	}
+	if len(inner.Provider) > 0 || len(inner.Stage) > 0 || inner.Kind != nil {
+		t.Fatalf("不应修改底层错误: %+v", inner)
+	}
+
+	// 未经包装的服务商错误
+	err = server.wrapError(StageExchange, newProviderError(http.StatusBadRequest, "100019", ""))
+	if !errors.As(err, &providerErr) || providerErr.Err != nil || err.Error() != "qq exchange: 100019" || !errors.Is(err, ErrInvalidGrant) {
+		t.Fatalf("包装结果错误: %v %+v", err, providerErr)
+	}
+}
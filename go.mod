@@ -2,4 +2,4 @@ module github.com/juxiaoming/pkg_login
 
 go 1.21.8
 
-require github.com/google/uuid v1.6.0 // indirect
+require github.com/google/uuid v1.6.0
@@ -0,0 +1,93 @@
+package pkg_login
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"net/http"
+)
+
+// StateCookieName 【LoginHandler】写入浏览器的state绑定cookie，【CallbackHandler】校验回调中的state与之一致，防止登录CSRF
+const StateCookieName = "pkg_login_state"
+
+// LoginHandler 签发state并跳转到服务商授权页，可直接注册到任意http.ServeMux；
+// state的摘要写入【StateCookieName】cookie，与发起登录的浏览器绑定
+func LoginHandler(server *Server, opts ...RedirectOption) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		redirectUrl, state, err := server.RedirectUrlContext(r.Context(), opts...)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		http.SetCookie(w, &http.Cookie{
+			Name:     StateCookieName,
+			Value:    stateDigest(state),
+			Path:     "/",
+			MaxAge:   int(server.stateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   true,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, redirectUrl, http.StatusFound)
+	})
+}
+
+// CallbackHandler 处理授权回调：使用【Server.ParseCallback】按服务商格式解析回调参数，校验state与【LoginHandler】写入的cookie一致后
+// 换取账户信息交给onSuccess，不一致时返回【ErrInvalidState】，避免攻击者诱导用户使用攻击者的code登录；
+// 任一步骤失败时调用onError，onError为nil时按错误分类返回对应的http状态码
+func CallbackHandler(server *Server, onSuccess func(w http.ResponseWriter, r *http.Request, userinfo *Userinfo), onError func(w http.ResponseWriter, r *http.Request, err error)) http.Handler {
+	if onError == nil {
+		onError = func(w http.ResponseWriter, r *http.Request, err error) {
+			writeError(w, err)
+		}
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cookie, _ := r.Cookie(StateCookieName)
+		// state只能使用一次，校验前先清除cookie
+		http.SetCookie(w, &http.Cookie{Name: StateCookieName, Path: "/", MaxAge: -1, HttpOnly: true, Secure: true, SameSite: http.SameSiteLaxMode})
+
+		callback, err := server.ParseCallback(r)
+		if err != nil {
+			onError(w, r, err)
+			return
+		}
+		if cookie == nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(stateDigest(callback.State))) != 1 {
+			onError(w, r, server.wrapError(StageAuthorize, &ProviderError{Description: "state与发起登录的浏览器不一致", Kind: ErrInvalidState}))
+			return
+		}
+
+		userinfo, err := server.LoginContext(r.Context(), callback.Code, callback.State)
+		if err != nil {
+			onError(w, r, err)
+			return
+		}
+
+		onSuccess(w, r, userinfo)
+	})
+}
+
+// stateDigest cookie中只保存state的摘要
+func stateDigest(state string) string {
+	sum := sha256.Sum256([]byte(state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// writeError 默认错误响应，只返回状态码描述，避免向用户暴露服务商错误详情
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalidState), errors.Is(err, ErrInvalidGrant):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrAccessDenied), errors.Is(err, ErrEmailNotVerified):
+		status = http.StatusForbidden
+	case errors.Is(err, ErrProviderUnavailable):
+		status = http.StatusServiceUnavailable
+	case errors.Is(err, ErrInvalidToken), errors.Is(err, ErrInvalidIDToken), errors.Is(err, ErrInvalidResponse):
+		status = http.StatusBadGateway
+	}
+
+	http.Error(w, http.StatusText(status), status)
+}
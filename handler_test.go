@@ -0,0 +1,95 @@
+package pkg_login
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+func TestCallbackHandlerStateCookie(t *testing.T) {
+	hits := &atomic.Int32{}
+	server, err := NewClient(NewGithubConf("github_id", "github_secret", "https://example.com/callback"),
+		WithStateStore(NewMemoryStateStore()),
+		WithTransport(roundTripFunc(func(req *http.Request) (*http.Response, error) {
+			hits.Add(1)
+			return nil, errors.New("upstream unavailable")
+		})),
+	).NewServer(ImplementGithub)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+
+	// login 通过LoginHandler发起登录，返回state与写入的cookie
+	login := func(t *testing.T) (string, *http.Cookie) {
+		t.Helper()
+
+		recorder := httptest.NewRecorder()
+		LoginHandler(server).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/login", nil))
+		if recorder.Code != http.StatusFound {
+			t.Fatalf("期望302，实际%d", recorder.Code)
+		}
+		location, _ := recorder.Result().Location()
+		for _, cookie := range recorder.Result().Cookies() {
+			if cookie.Name == StateCookieName {
+				if !cookie.HttpOnly || !cookie.Secure || cookie.SameSite != http.SameSiteLaxMode || cookie.MaxAge <= 0 {
+					t.Fatalf("cookie属性错误: %+v", cookie)
+				}
+				return location.Query().Get("state"), cookie
+			}
+		}
+		t.Fatal("未写入state cookie")
+		return "", nil
+	}
+
+	tests := []struct {
+		name         string
+		noCookie     bool
+		victimCookie bool // 使用受害者浏览器中的cookie
+		wantHits     int32
+	}{
+		{name: "缺失cookie", noCookie: true},
+		{name: "cookie与state不一致", victimCookie: true},
+		{name: "cookie与state一致", wantHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits.Store(0)
+			// 攻击者自行发起登录获得的state
+			state, cookie := login(t)
+			if tt.victimCookie {
+				_, cookie = login(t)
+			}
+
+			var callbackErr error
+			handler := CallbackHandler(server, func(w http.ResponseWriter, r *http.Request, userinfo *Userinfo) {
+				t.Fatal("不应登录成功")
+			}, func(w http.ResponseWriter, r *http.Request, err error) {
+				callbackErr = err
+			})
+
+			req := httptest.NewRequest(http.MethodGet, "/callback?code=code&state="+state, nil)
+			if !tt.noCookie {
+				req.AddCookie(cookie)
+			}
+			recorder := httptest.NewRecorder()
+			handler.ServeHTTP(recorder, req)
+
+			if got := hits.Load(); got != tt.wantHits {
+				t.Fatalf("期望请求服务商%d次，实际%d次", tt.wantHits, got)
+			}
+			if tt.wantHits == 0 && !errors.Is(callbackErr, ErrInvalidState) {
+				t.Fatalf("期望ErrInvalidState，实际: %v", callbackErr)
+			}
+			cleared := false
+			for _, cookie := range recorder.Result().Cookies() {
+				cleared = cleared || (cookie.Name == StateCookieName && cookie.MaxAge < 0)
+			}
+			if !cleared {
+				t.Fatal("回调后应清除state cookie")
+			}
+		})
+	}
+}
@@ -0,0 +1,367 @@
+package pkg_login
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+/**
+ * Doc : https://opendocs.alipay.com/open/284/web
+ */
+
+const (
+	AlipayRedirectPath = "https://openauth.alipay.com/oauth2/publicAppAuthorize.htm" // 支付宝获取auth_code地址
+	AlipayGatewayPath  = "https://openapi.alipay.com/gateway.do"                     // 支付宝网关，token及用户信息均通过网关调用
+	AlipayTokenMethod  = "alipay.system.oauth.token"                                 // 支付宝获取token接口
+	AlipayUserMethod   = "alipay.user.info.share"                                    // 支付宝获取用户信息接口
+)
+
+// NewAlipayConf privateKey为应用私钥，publicKey为支付宝公钥，均支持PEM或去掉头尾的base64格式
+func NewAlipayConf(id, privateKey, publicKey, redirectUrl string) *Config {
+	return &Config{
+		AlipayId:          id,
+		AlipayPrivateKey:  privateKey,
+		AlipayPublicKey:   publicKey,
+		AlipayRedirectUrl: redirectUrl,
+	}
+}
+
+type AlipayServer struct {
+	conf       *Config
+	httpClient *http.Client
+	privateKey *rsa.PrivateKey
+	publicKey  *rsa.PublicKey
+}
+
+func init() {
+	registerProvider(ImplementAlipay, ProviderAlipay, newAlipayProvider)
+}
+
+func newAlipayProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.AlipayId) == 0 || len(p.Config.AlipayPrivateKey) == 0 || len(p.Config.AlipayPublicKey) == 0 || len(p.Config.AlipayRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newAlipayServer(p.Config, p.HttpClient)
+}
+
+func newAlipayServer(conf *Config, httpClient *http.Client) (*AlipayServer, error) {
+	privateKey, err := parseRsaPrivateKey(conf.AlipayPrivateKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w:应用私钥解析失败:%v", ErrNotConfigured, err)
+	}
+	publicKey, err := parseRsaPublicKey(conf.AlipayPublicKey)
+	if err != nil {
+		return nil, fmt.Errorf("%w:支付宝公钥解析失败:%v", ErrNotConfigured, err)
+	}
+
+	return &AlipayServer{conf: conf, httpClient: httpClient, privateKey: privateKey, publicKey: publicKey}, nil
+}
+
+// SupportPKCE 支付宝授权不支持PKCE
+func (a *AlipayServer) SupportPKCE() bool {
+	return false
+}
+
+func (a *AlipayServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(AlipayRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("app_id", a.conf.AlipayId)
+	queryParams.Add("scope", "auth_user")
+	queryParams.Add("redirect_uri", a.conf.AlipayRedirectUrl)
+	queryParams.Add("state", state.State)
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+// AlipayError 支付宝网关通用错误结构，code为10000时表示成功
+type AlipayError struct {
+	Code    string `json:"code"`
+	Msg     string `json:"msg"`
+	SubCode string `json:"sub_code"`
+	SubMsg  string `json:"sub_msg"`
+}
+
+func (e *AlipayError) err() error {
+	if len(e.Code) == 0 || e.Code == "10000" {
+		return nil
+	}
+	if len(e.SubCode) > 0 {
+		return newProviderError(0, e.SubCode, e.SubMsg)
+	}
+
+	return newProviderError(0, e.Code, e.Msg)
+}
+
+// gateway 调用支付宝网关，请求使用RSA2签名，响应使用支付宝公钥验签后解析到v，同时返回响应节点原始字段
+func (a *AlipayServer) gateway(ctx context.Context, method string, params map[string]string, v any) (map[string]any, error) {
+	formData := url.Values{}
+	formData.Set("app_id", a.conf.AlipayId)
+	formData.Set("method", method)
+	formData.Set("format", "JSON")
+	formData.Set("charset", "utf-8")
+	formData.Set("sign_type", "RSA2")
+	formData.Set("timestamp", time.Now().In(time.FixedZone("CST", 8*3600)).Format("2006-01-02 15:04:05"))
+	formData.Set("version", "1.0")
+	for key, val := range params {
+		formData.Set(key, val)
+	}
+
+	sign, err := a.sign(formData)
+	if err != nil {
+		return nil, fmt.Errorf("请求签名失败:%w", err)
+	}
+	formData.Set("sign", sign)
+
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded;charset=utf-8"}
+	response, err := postBase(ctx, a.httpClient, AlipayGatewayPath, formData.Encode(), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	body, err := readResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	responseMap := make(map[string]json.RawMessage)
+	if err := json.Unmarshal(body, &responseMap); err != nil {
+		return nil, err
+	}
+
+	var signature string
+	if rawSign, ok := responseMap["sign"]; ok {
+		if err := json.Unmarshal(rawSign, &signature); err != nil {
+			return nil, err
+		}
+	}
+
+	// 部分错误（如app_id无效）响应不带签名，直接返回错误信息
+	if content, ok := responseMap["error_response"]; ok {
+		if len(signature) > 0 {
+			if err := a.verify(content, signature); err != nil {
+				return nil, err
+			}
+		}
+		errorStruct := &AlipayError{}
+		if err := json.Unmarshal(content, errorStruct); err != nil {
+			return nil, err
+		}
+		if err := errorStruct.err(); err != nil {
+			return nil, err
+		}
+		return nil, invalidResponse("支付宝网关返回未知错误")
+	}
+
+	content, ok := responseMap[strings.ReplaceAll(method, ".", "_")+"_response"]
+	if !ok {
+		return nil, invalidResponse("支付宝网关响应缺失")
+	}
+	if len(signature) == 0 {
+		return nil, invalidResponse("支付宝网关响应缺失签名")
+	}
+	if err := a.verify(content, signature); err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(bytes.NewReader(content), v)
+}
+
+// sign 参数按key排序后以k=v&k=v拼接（排除sign及空值），使用应用私钥SHA256WithRSA签名
+func (a *AlipayServer) sign(params url.Values) (string, error) {
+	keys := make([]string, 0, len(params))
+	for key := range params {
+		if key == "sign" || len(params.Get(key)) == 0 {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, 0, len(keys))
+	for _, key := range keys {
+		pairs = append(pairs, key+"="+params.Get(key))
+	}
+
+	hashed := sha256.Sum256([]byte(strings.Join(pairs, "&")))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.privateKey, crypto.SHA256, hashed[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(signature), nil
+}
+
+// verify 使用支付宝公钥校验响应节点原文签名
+func (a *AlipayServer) verify(content []byte, signature string) error {
+	signatureBytes, err := base64.StdEncoding.DecodeString(signature)
+	if err != nil {
+		return invalidResponse("响应签名格式错误:" + err.Error())
+	}
+
+	hashed := sha256.Sum256(content)
+	if err := rsa.VerifyPKCS1v15(a.publicKey, crypto.SHA256, hashed[:], signatureBytes); err != nil {
+		return invalidResponse("响应验签失败:" + err.Error())
+	}
+
+	return nil
+}
+
+type AlipayTokenResponse struct {
+	AlipayError
+	UserId       string      `json:"user_id"`
+	OpenId       string      `json:"open_id"`
+	AccessToken  string      `json:"access_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	RefreshToken string      `json:"refresh_token"`
+	ReExpiresIn  json.Number `json:"re_expires_in"`
+	AuthStart    string      `json:"auth_start"`
+}
+
+// ExchangeContext 使用auth_code换取token，user_id、open_id保存在Raw中
+func (a *AlipayServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	params := map[string]string{
+		"grant_type": "authorization_code",
+		"code":       code,
+	}
+
+	responseStruct := &AlipayTokenResponse{}
+	raw, err := a.gateway(ctx, AlipayTokenMethod, params, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	expiresIn, _ := responseStruct.ExpiresIn.Int64()
+
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		Expiry:       expiryIn(expiresIn),
+		Raw:          raw,
+	}, nil
+}
+
+type AlipayUserInfo struct {
+	AlipayError
+	UserId   string `json:"user_id"`
+	OpenId   string `json:"open_id"`
+	Avatar   string `json:"avatar"`
+	NickName string `json:"nick_name"`
+	Province string `json:"province"`
+	City     string `json:"city"`
+	Gender   string `json:"gender"`
+}
+
+func (a *AlipayServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := a.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return a.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (a *AlipayServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	responseStruct := &AlipayUserInfo{}
+	raw, err := a.gateway(ctx, AlipayUserMethod, map[string]string{"auth_token": token.AccessToken}, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	// 新应用只返回open_id，老应用只返回user_id，用户信息中缺失时使用token中的值
+	userId, openid := responseStruct.UserId, responseStruct.OpenId
+	if len(userId) == 0 {
+		userId = token.rawString("user_id")
+	}
+	if len(openid) == 0 {
+		openid = token.rawString("open_id")
+	}
+	if len(openid) == 0 {
+		openid = userId
+	}
+
+	return &Userinfo{
+		Openid:   openid,
+		UnionId:  userId,
+		NickName: responseStruct.NickName,
+		Avatar:   responseStruct.Avatar,
+		Raw:      raw,
+	}, nil
+}
+
+// pemBytes 兼容PEM格式及去掉头尾的base64格式密钥
+func pemBytes(key string) ([]byte, error) {
+	key = strings.TrimSpace(key)
+	if block, _ := pem.Decode([]byte(key)); block != nil {
+		return block.Bytes, nil
+	}
+
+	return base64.StdEncoding.DecodeString(key)
+}
+
+func parseRsaPrivateKey(key string) (*rsa.PrivateKey, error) {
+	der, err := pemBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed, err := x509.ParsePKCS8PrivateKey(der); err == nil {
+		privateKey, ok := parsed.(*rsa.PrivateKey)
+		if !ok {
+			return nil, errors.New("不是RSA私钥")
+		}
+		return privateKey, nil
+	}
+
+	return x509.ParsePKCS1PrivateKey(der)
+}
+
+func parseRsaPublicKey(key string) (*rsa.PublicKey, error) {
+	der, err := pemBytes(key)
+	if err != nil {
+		return nil, err
+	}
+
+	if parsed, err := x509.ParsePKIXPublicKey(der); err == nil {
+		publicKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return nil, errors.New("不是RSA公钥")
+		}
+		return publicKey, nil
+	}
+
+	return x509.ParsePKCS1PublicKey(der)
+}
@@ -0,0 +1,182 @@
+package pkg_login
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// rewriteTransport 将请求转发到测试服务，用于地址为常量的服务商接口
+type rewriteTransport struct {
+	target *url.URL
+}
+
+func (t rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.URL.Scheme, req.URL.Host = t.target.Scheme, t.target.Host
+
+	return http.DefaultTransport.RoundTrip(req)
+}
+
+func encodeTestPrivateKey(t *testing.T, key *rsa.PrivateKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatalf("私钥编码失败: %v", err)
+	}
+
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+// encodeTestPublicKey 去掉PEM头尾的base64格式，与支付宝开放平台下载的公钥一致
+func encodeTestPublicKey(t *testing.T, key *rsa.PublicKey) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		t.Fatalf("公钥编码失败: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(der)
+}
+
+func signTestAlipayContent(t *testing.T, key *rsa.PrivateKey, content string) string {
+	t.Helper()
+
+	hashed := sha256.Sum256([]byte(content))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("签名失败: %v", err)
+	}
+
+	return base64.StdEncoding.EncodeToString(signature)
+}
+
+// verifyTestAlipayRequest 按支付宝规则使用应用公钥校验请求签名
+func verifyTestAlipayRequest(form url.Values, publicKey *rsa.PublicKey) error {
+	signature, err := base64.StdEncoding.DecodeString(form.Get("sign"))
+	if err != nil {
+		return err
+	}
+
+	params := url.Values{}
+	for key := range form {
+		if key != "sign" {
+			params.Set(key, form.Get(key))
+		}
+	}
+	// url.Values.Encode按key排序，解码后即为待签名字符串
+	content, err := url.QueryUnescape(params.Encode())
+	if err != nil {
+		return err
+	}
+
+	hashed := sha256.Sum256([]byte(content))
+	return rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature)
+}
+
+// newTestAlipayServer 创建连接到测试网关的支付宝服务，respond返回网关响应体
+func newTestAlipayServer(t *testing.T, appKey, alipayKey *rsa.PrivateKey, respond func(form url.Values) string) *AlipayServer {
+	t.Helper()
+
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			t.Errorf("请求参数解析失败: %v", err)
+			return
+		}
+		if err := verifyTestAlipayRequest(r.PostForm, &appKey.PublicKey); err != nil {
+			t.Errorf("请求验签失败: %v", err)
+		}
+		w.Header().Set("Content-Type", "application/json;charset=utf-8")
+		_, _ = w.Write([]byte(respond(r.PostForm)))
+	}))
+	t.Cleanup(gateway.Close)
+
+	target, _ := url.Parse(gateway.URL)
+	conf := NewAlipayConf("2021000000000000", encodeTestPrivateKey(t, appKey), encodeTestPublicKey(t, &alipayKey.PublicKey), "https://example.com/callback")
+	server, err := newAlipayServer(conf, &http.Client{Transport: rewriteTransport{target: target}})
+	if err != nil {
+		t.Fatalf("创建支付宝服务失败: %v", err)
+	}
+
+	return server
+}
+
+const testAlipayTokenContent = `{"code":"10000","msg":"Success","user_id":"2088000000000000","access_token":"authusrB123","expires_in":1296000,"refresh_token":"authusrB456","re_expires_in":2592000}`
+
+func TestAlipayGatewaySignVerify(t *testing.T) {
+	appKey := newTestRsaKey(t)
+	alipayKey := newTestRsaKey(t)
+
+	server := newTestAlipayServer(t, appKey, alipayKey, func(form url.Values) string {
+		if form.Get("method") != AlipayTokenMethod || form.Get("code") != "auth-code" || form.Get("sign_type") != "RSA2" {
+			t.Errorf("请求参数错误: %v", form)
+		}
+		return `{"alipay_system_oauth_token_response":` + testAlipayTokenContent + `,"sign":"` + signTestAlipayContent(t, alipayKey, testAlipayTokenContent) + `"}`
+	})
+
+	token, err := server.ExchangeContext(context.Background(), "auth-code", nil)
+	if err != nil {
+		t.Fatalf("换取token失败: %v", err)
+	}
+	if token.AccessToken != "authusrB123" || token.RefreshToken != "authusrB456" || token.rawString("user_id") != "2088000000000000" {
+		t.Fatalf("token解析错误: %+v", token)
+	}
+}
+
+func TestAlipayGatewayRejectsInvalidResponse(t *testing.T) {
+	appKey := newTestRsaKey(t)
+	alipayKey := newTestRsaKey(t)
+	otherKey := newTestRsaKey(t)
+
+	tampered := strings.Replace(testAlipayTokenContent, "authusrB123", "authusrEvil", 1)
+	tests := map[string]string{
+		"响应被篡改":    `{"alipay_system_oauth_token_response":` + tampered + `,"sign":"` + signTestAlipayContent(t, alipayKey, testAlipayTokenContent) + `"}`,
+		"非支付宝私钥签名": `{"alipay_system_oauth_token_response":` + testAlipayTokenContent + `,"sign":"` + signTestAlipayContent(t, otherKey, testAlipayTokenContent) + `"}`,
+		"缺失签名":     `{"alipay_system_oauth_token_response":` + testAlipayTokenContent + `}`,
+		"签名格式错误":   `{"alipay_system_oauth_token_response":` + testAlipayTokenContent + `,"sign":"!!!"}`,
+		"缺失响应节点":   `{"sign":"` + signTestAlipayContent(t, alipayKey, testAlipayTokenContent) + `"}`,
+	}
+
+	for name, body := range tests {
+		t.Run(name, func(t *testing.T) {
+			server := newTestAlipayServer(t, appKey, alipayKey, func(url.Values) string { return body })
+
+			token, err := server.ExchangeContext(context.Background(), "auth-code", nil)
+			if !errors.Is(err, ErrInvalidResponse) {
+				t.Fatalf("期望ErrInvalidResponse，实际: %v, %+v", err, token)
+			}
+		})
+	}
+}
+
+func TestAlipayGatewayError(t *testing.T) {
+	appKey := newTestRsaKey(t)
+	alipayKey := newTestRsaKey(t)
+
+	content := `{"code":"40002","msg":"Invalid Arguments","sub_code":"isv.code-invalid","sub_msg":"授权码code无效"}`
+	server := newTestAlipayServer(t, appKey, alipayKey, func(url.Values) string {
+		return `{"error_response":` + content + `,"sign":"` + signTestAlipayContent(t, alipayKey, content) + `"}`
+	})
+
+	_, err := server.ExchangeContext(context.Background(), "auth-code", nil)
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) || providerErr.Code != "isv.code-invalid" {
+		t.Fatalf("期望isv.code-invalid错误，实际: %v", err)
+	}
+	if kind := classifyProviderError(ProviderAlipay, StageExchange, providerErr); kind != ErrInvalidGrant {
+		t.Fatalf("期望分类为ErrInvalidGrant，实际: %v", kind)
+	}
+}
@@ -1,8 +1,10 @@
 package pkg_login
 
 import (
+	"context"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 )
 
@@ -25,24 +27,43 @@ func NewDingDingConf(id, secret, redirectUrl string) *Config {
 }
 
 type DingDingServer struct {
+	conf       *Config
+	httpClient *http.Client
 }
 
-func newDingDingServer() *DingDingServer {
-	return &DingDingServer{}
+func init() {
+	registerProvider(ImplementDingDing, ProviderDingDing, newDingDingProvider)
 }
 
-func (d *DingDingServer) RedirectUrl() (string, error) {
+func newDingDingProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.DingDingId) == 0 || len(p.Config.DingDingSecret) == 0 || len(p.Config.DingDingRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newDingDingServer(p.Config, p.HttpClient), nil
+}
+
+func newDingDingServer(conf *Config, httpClient *http.Client) *DingDingServer {
+	return &DingDingServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE 钉钉授权不支持PKCE
+func (d *DingDingServer) SupportPKCE() bool {
+	return false
+}
+
+func (d *DingDingServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
 	parsedURL, err := url.Parse(DingDingRedirectPath)
 	if err != nil {
 		return "", err
 	}
 
 	queryParams := url.Values{}
-	queryParams.Add("redirect_uri", config.DingDingRedirectUrl)
-	queryParams.Add("client_id", config.DingDingId)
+	queryParams.Add("redirect_uri", d.conf.DingDingRedirectUrl)
+	queryParams.Add("client_id", d.conf.DingDingId)
 	queryParams.Add("response_type", "code")
 	queryParams.Add("scope", "openid")
-	queryParams.Add("state", "authCode")
+	queryParams.Add("state", state.State)
 	queryParams.Add("prompt", "consent")
 
 	parsedURL.RawQuery = queryParams.Encode()
@@ -54,37 +75,62 @@ type DingDingTokenResponse struct {
 	ExpireIn     int    `json:"expireIn"`
 	AccessToken  string `json:"accessToken"`
 	RefreshToken string `json:"refreshToken"`
+	Code         string `json:"code"`
 	Message      string `json:"message"`
 }
 
-func (d *DingDingServer) token(code string) (string, error) {
+// ExchangeContext 使用code换取token
+func (d *DingDingServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
 	payload := map[string]string{
-		"clientId":     config.DingDingId,
-		"clientSecret": config.DingDingSecret,
+		"clientId":     d.conf.DingDingId,
+		"clientSecret": d.conf.DingDingSecret,
 		"code":         code,
 		"grantType":    "authorization_code",
 	}
 
+	return d.tokenRequest(ctx, payload)
+}
+
+// RefreshContext 使用refresh_token刷新token
+func (d *DingDingServer) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	payload := map[string]string{
+		"clientId":     d.conf.DingDingId,
+		"clientSecret": d.conf.DingDingSecret,
+		"refreshToken": refreshToken,
+		"grantType":    "refresh_token",
+	}
+
+	return d.tokenRequest(ctx, payload)
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (d *DingDingServer) tokenRequest(ctx context.Context, payload map[string]string) (*Token, error) {
 	payloadBytes, _ := json.Marshal(payload)
 	headers := map[string]string{"Content-Type": "application/json"}
-	response, err := postBase(DingDingTokenPath, string(payloadBytes), headers)
+	response, err := postBase(ctx, d.httpClient, DingDingTokenPath, string(payloadBytes), headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
 	responseStruct := &DingDingTokenResponse{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
-		return "", err
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(responseStruct.Message) != 0 {
-		return "", errors.New(responseStruct.Message)
+		return nil, newProviderError(response.StatusCode, responseStruct.Code, responseStruct.Message)
 	}
 
-	return responseStruct.AccessToken, nil
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		Expiry:       expiryIn(int64(responseStruct.ExpireIn)),
+		Raw:          raw,
+	}, nil
 }
 
 type DingDingUserInfo struct {
@@ -95,17 +141,24 @@ type DingDingUserInfo struct {
 	Mobile    string `json:"mobile"`
 	StateCode string `json:"stateCode"`
 	Visitor   bool   `json:"visitor"`
+	Email     string `json:"email"`
+	Code      string `json:"code"`
 	Message   string `json:"message"`
 }
 
-func (d *DingDingServer) GetUserinfo(code string) (*Userinfo, error) {
-	token, err := d.token(code)
+func (d *DingDingServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := d.ExchangeContext(ctx, code, state)
 	if err != nil {
-		return nil, errors.New("token获取失败:" + err.Error())
+		return nil, fmt.Errorf("token获取失败:%w", err)
 	}
 
-	headers := map[string]string{"x-acs-dingtalk-access-token": token}
-	response, err := getBase(DingDingUserInfoPath, headers)
+	return d.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (d *DingDingServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	headers := map[string]string{"x-acs-dingtalk-access-token": token.AccessToken}
+	response, err := getBase(ctx, d.httpClient, DingDingUserInfoPath, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -114,12 +167,13 @@ func (d *DingDingServer) GetUserinfo(code string) (*Userinfo, error) {
 	}()
 
 	responseStruct := &DingDingUserInfo{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
 		return nil, err
 	}
 
 	if len(responseStruct.Message) > 0 {
-		return nil, errors.New(responseStruct.Message)
+		return nil, newProviderError(response.StatusCode, responseStruct.Code, responseStruct.Message)
 	}
 
 	return &Userinfo{
@@ -128,5 +182,7 @@ func (d *DingDingServer) GetUserinfo(code string) (*Userinfo, error) {
 		NickName: responseStruct.Nick,
 		Avatar:   responseStruct.AvatarUrl,
 		Mobile:   responseStruct.Mobile,
+		Email:    responseStruct.Email,
+		Raw:      raw,
 	}, nil
 }
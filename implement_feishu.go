@@ -1,8 +1,9 @@
 package pkg_login
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 )
 
@@ -25,23 +26,42 @@ func NewFeiShuConf(id, secret, redirectUrl string) *Config {
 }
 
 type FeiShuServer struct {
+	conf       *Config
+	httpClient *http.Client
 }
 
-func newFeiShuServer() *FeiShuServer {
-	return &FeiShuServer{}
+func init() {
+	registerProvider(ImplementFeiShu, ProviderFeiShu, newFeiShuProvider)
 }
 
-func (f *FeiShuServer) RedirectUrl() (string, error) {
+func newFeiShuProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.FeiShuId) == 0 || len(p.Config.FeiShuSecret) == 0 || len(p.Config.FeiShuRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newFeiShuServer(p.Config, p.HttpClient), nil
+}
+
+func newFeiShuServer(conf *Config, httpClient *http.Client) *FeiShuServer {
+	return &FeiShuServer{conf: conf, httpClient: httpClient}
+}
+
+func (f *FeiShuServer) SupportPKCE() bool {
+	return true
+}
+
+func (f *FeiShuServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
 	parsedURL, err := url.Parse(FeiShuRedirectPath)
 	if err != nil {
 		return "", err
 	}
 
 	queryParams := url.Values{}
-	queryParams.Add("redirect_uri", config.FeiShuRedirectUrl)
-	queryParams.Add("client_id", config.FeiShuId)
+	queryParams.Add("redirect_uri", f.conf.FeiShuRedirectUrl)
+	queryParams.Add("client_id", f.conf.FeiShuId)
 	queryParams.Add("response_type", "code")
-	queryParams.Add("state", rand32Str())
+	queryParams.Add("state", state.State)
+	addCodeChallenge(queryParams, state)
 
 	parsedURL.RawQuery = queryParams.Encode()
 
@@ -59,33 +79,59 @@ type FeiShuTokenResponse struct {
 	ErrorDescription string `json:"error_description"`
 }
 
-func (f *FeiShuServer) token(code string) (string, error) {
+// ExchangeContext 使用code换取token
+func (f *FeiShuServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
 	formData := url.Values{}
 	formData.Set("code", code)
-	formData.Set("client_id", config.FeiShuId)
-	formData.Set("client_secret", config.FeiShuSecret)
-	formData.Set("redirect_uri", config.FeiShuRedirectUrl)
+	formData.Set("client_id", f.conf.FeiShuId)
+	formData.Set("client_secret", f.conf.FeiShuSecret)
+	formData.Set("redirect_uri", f.conf.FeiShuRedirectUrl)
 	formData.Set("grant_type", "authorization_code")
+	addCodeVerifier(formData, state)
+
+	return f.tokenRequest(ctx, formData)
+}
+
+// RefreshContext 使用refresh_token刷新token
+func (f *FeiShuServer) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("client_id", f.conf.FeiShuId)
+	formData.Set("client_secret", f.conf.FeiShuSecret)
+	formData.Set("grant_type", "refresh_token")
 
+	return f.tokenRequest(ctx, formData)
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (f *FeiShuServer) tokenRequest(ctx context.Context, formData url.Values) (*Token, error) {
 	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
-	response, err := postBase(FeiShuTokenPath, formData.Encode(), headers)
+	response, err := postBase(ctx, f.httpClient, FeiShuTokenPath, formData.Encode(), headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
 	responseStruct := &FeiShuTokenResponse{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
-		return "", err
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(responseStruct.Error) != 0 {
-		return "", errors.New(responseStruct.ErrorDescription)
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
 	}
 
-	return responseStruct.AccessToken, nil
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		TokenType:    responseStruct.TokenType,
+		Expiry:       expiryIn(int64(responseStruct.ExpiresIn)),
+		Scopes:       splitScopes(responseStruct.Scope),
+		Raw:          raw,
+	}, nil
 }
 
 type FeiShuUserInfo struct {
@@ -102,17 +148,23 @@ type FeiShuUserInfo struct {
 	UnionId      string `json:"union_id"`
 	UserId       string `json:"user_id"`
 	Mobile       string `json:"mobile"`
+	Email        string `json:"email"`
 	Message      string `json:"message"`
 }
 
-func (f *FeiShuServer) GetUserinfo(code string) (*Userinfo, error) {
-	token, err := f.token(code)
+func (f *FeiShuServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := f.ExchangeContext(ctx, code, state)
 	if err != nil {
-		return nil, errors.New("token获取失败:" + err.Error())
+		return nil, fmt.Errorf("token获取失败:%w", err)
 	}
 
-	headers := map[string]string{"Authorization": "Bearer " + token}
-	response, err := getBase(FeiShuUserInfoPath, headers)
+	return f.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (f *FeiShuServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	headers := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+	response, err := getBase(ctx, f.httpClient, FeiShuUserInfoPath, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -121,12 +173,13 @@ func (f *FeiShuServer) GetUserinfo(code string) (*Userinfo, error) {
 	}()
 
 	responseStruct := &FeiShuUserInfo{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
 		return nil, err
 	}
 
 	if len(responseStruct.Message) > 0 {
-		return nil, errors.New(responseStruct.Message)
+		return nil, newProviderError(response.StatusCode, "", responseStruct.Message)
 	}
 
 	return &Userinfo{
@@ -135,5 +188,7 @@ func (f *FeiShuServer) GetUserinfo(code string) (*Userinfo, error) {
 		NickName: responseStruct.Name,
 		Avatar:   responseStruct.AvatarUrl,
 		Mobile:   responseStruct.Mobile,
+		Email:    responseStruct.Email,
+		Raw:      raw,
 	}, nil
 }
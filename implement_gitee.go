@@ -1,8 +1,9 @@
 package pkg_login
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 )
@@ -26,22 +27,42 @@ func NewGiteeConf(id, secret, redirectUrl string) *Config {
 }
 
 type GiteeServer struct {
+	conf       *Config
+	httpClient *http.Client
 }
 
-func newGiteeServer() *GiteeServer {
-	return &GiteeServer{}
+func init() {
+	registerProvider(ImplementGitee, ProviderGitee, newGiteeProvider)
 }
 
-func (g *GiteeServer) RedirectUrl() (string, error) {
+func newGiteeProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.GiteeId) == 0 || len(p.Config.GiteeSecret) == 0 || len(p.Config.GiteeRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newGiteeServer(p.Config, p.HttpClient), nil
+}
+
+func newGiteeServer(conf *Config, httpClient *http.Client) *GiteeServer {
+	return &GiteeServer{conf: conf, httpClient: httpClient}
+}
+
+func (g *GiteeServer) SupportPKCE() bool {
+	return true
+}
+
+func (g *GiteeServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
 	parsedURL, err := url.Parse(GiteeRedirectPath)
 	if err != nil {
 		return "", err
 	}
 
 	queryParams := url.Values{}
-	queryParams.Add("client_id", config.GiteeId)
-	queryParams.Add("redirect_uri", config.GiteeRedirectUrl)
+	queryParams.Add("client_id", g.conf.GiteeId)
+	queryParams.Add("redirect_uri", g.conf.GiteeRedirectUrl)
 	queryParams.Add("response_type", "code")
+	queryParams.Add("state", state.State)
+	addCodeChallenge(queryParams, state)
 
 	parsedURL.RawQuery = queryParams.Encode()
 
@@ -59,33 +80,59 @@ type GiteeTokenResponse struct {
 	ErrorDescription string `json:"error_description"`
 }
 
-func (g *GiteeServer) token(code string) (string, error) {
+// ExchangeContext 使用code换取token
+func (g *GiteeServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
 	formData := url.Values{}
 	formData.Set("code", code)
-	formData.Set("client_id", config.GiteeId)
-	formData.Set("client_secret", config.GiteeSecret)
-	formData.Set("redirect_uri", config.GiteeRedirectUrl)
+	formData.Set("client_id", g.conf.GiteeId)
+	formData.Set("client_secret", g.conf.GiteeSecret)
+	formData.Set("redirect_uri", g.conf.GiteeRedirectUrl)
 	formData.Set("grant_type", "authorization_code")
+	addCodeVerifier(formData, state)
+
+	return g.tokenRequest(ctx, formData)
+}
 
+// RefreshContext 使用refresh_token刷新token
+func (g *GiteeServer) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("client_id", g.conf.GiteeId)
+	formData.Set("client_secret", g.conf.GiteeSecret)
+	formData.Set("grant_type", "refresh_token")
+
+	return g.tokenRequest(ctx, formData)
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (g *GiteeServer) tokenRequest(ctx context.Context, formData url.Values) (*Token, error) {
 	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
-	response, err := postBase(GiteeTokenPath, formData.Encode(), headers)
+	response, err := postBase(ctx, g.httpClient, GiteeTokenPath, formData.Encode(), headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
 	responseStruct := &GiteeTokenResponse{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
-		return "", err
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(responseStruct.Error) != 0 {
-		return "", errors.New(responseStruct.ErrorDescription)
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
 	}
 
-	return responseStruct.AccessToken, nil
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		TokenType:    responseStruct.TokenType,
+		Expiry:       expiryIn(int64(responseStruct.ExpiresIn)),
+		Scopes:       splitScopes(responseStruct.Scope),
+		Raw:          raw,
+	}, nil
 }
 
 type GiteeUserInfo struct {
@@ -93,24 +140,31 @@ type GiteeUserInfo struct {
 	Name      string `json:"name"`
 	Id        int64  `json:"id"`
 	AvatarUrl string `json:"avatar_url"`
+	HtmlUrl   string `json:"html_url"`
+	Email     string `json:"email"`
 	Message   string `json:"message"`
 }
 
-func (g *GiteeServer) GetUserinfo(code string) (*Userinfo, error) {
-	token, err := g.token(code)
+func (g *GiteeServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := g.ExchangeContext(ctx, code, state)
 	if err != nil {
-		return nil, errors.New("token获取失败:" + err.Error())
+		return nil, fmt.Errorf("token获取失败:%w", err)
 	}
 
+	return g.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (g *GiteeServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
 	parsedURL, err := url.Parse(GiteeUserInfoPath)
 	if err != nil {
 		return nil, err
 	}
 	queryParams := url.Values{}
-	queryParams.Add("access_token", token)
+	queryParams.Add("access_token", token.AccessToken)
 	parsedURL.RawQuery = queryParams.Encode()
 
-	response, err := getBase(parsedURL.String(), nil)
+	response, err := getBase(ctx, g.httpClient, parsedURL.String(), nil)
 	if err != nil {
 		return nil, err
 	}
@@ -119,17 +173,28 @@ func (g *GiteeServer) GetUserinfo(code string) (*Userinfo, error) {
 	}()
 
 	responseStruct := &GiteeUserInfo{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
 		return nil, err
 	}
 
 	if len(responseStruct.Message) > 0 {
-		return nil, errors.New(responseStruct.Message)
+		return nil, newProviderError(response.StatusCode, "", responseStruct.Message)
+	}
+
+	// id缺失时保持openid为空，由【Server】视为失败
+	var openid string
+	if responseStruct.Id > 0 {
+		openid = strconv.FormatInt(responseStruct.Id, 10)
 	}
 
 	return &Userinfo{
-		Openid:   strconv.Itoa(int(responseStruct.Id)),
-		NickName: responseStruct.Name,
-		Avatar:   responseStruct.AvatarUrl,
+		Openid:     openid,
+		NickName:   responseStruct.Name,
+		Avatar:     responseStruct.AvatarUrl,
+		Email:      responseStruct.Email,
+		Username:   responseStruct.Login,
+		ProfileURL: responseStruct.HtmlUrl,
+		Raw:        raw,
 	}, nil
 }
@@ -1,8 +1,11 @@
 package pkg_login
 
 import (
+	"context"
+	"encoding/base64"
 	"encoding/json"
-	"errors"
+	"fmt"
+	"net/http"
 	"net/url"
 	"strconv"
 )
@@ -12,9 +15,11 @@ import (
  */
 
 const (
-	GithubRedirectPath = "https://github.com/login/oauth/authorize"    // Github获取code地址
-	GithubTokenPath    = "https://github.com/login/oauth/access_token" // Github获取token地址
-	GithubUserInfoPath = "https://api.github.com/user"                 // Github获取用户信息接口
+	GithubRedirectPath = "https://github.com/login/oauth/authorize"     // Github获取code地址
+	GithubTokenPath    = "https://github.com/login/oauth/access_token"  // Github获取token地址
+	GithubUserInfoPath = "https://api.github.com/user"                  // Github获取用户信息接口
+	GithubEmailsPath   = "https://api.github.com/user/emails"           // Github获取邮箱列表接口，需要user或user:email授权
+	GithubRevokePath   = "https://api.github.com/applications/%s/grant" // Github撤销授权接口，%s为client_id
 )
 
 func NewGithubConf(id, secret, redirectUrl string) *Config {
@@ -26,23 +31,42 @@ func NewGithubConf(id, secret, redirectUrl string) *Config {
 }
 
 type GithubServer struct {
+	conf       *Config
+	httpClient *http.Client
 }
 
-func newGithubServer() *GithubServer {
-	return &GithubServer{}
+func init() {
+	registerProvider(ImplementGithub, ProviderGithub, newGithubProvider)
 }
 
-func (g *GithubServer) RedirectUrl() (string, error) {
+func newGithubProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.GithubId) == 0 || len(p.Config.GithubSecret) == 0 || len(p.Config.GithubRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newGithubServer(p.Config, p.HttpClient), nil
+}
+
+func newGithubServer(conf *Config, httpClient *http.Client) *GithubServer {
+	return &GithubServer{conf: conf, httpClient: httpClient}
+}
+
+func (g *GithubServer) SupportPKCE() bool {
+	return true
+}
+
+func (g *GithubServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
 	parsedURL, err := url.Parse(GithubRedirectPath)
 	if err != nil {
 		return "", err
 	}
 
 	queryParams := url.Values{}
-	queryParams.Add("client_id", config.GithubId)
-	queryParams.Add("redirect_uri", config.GithubRedirectUrl)
+	queryParams.Add("client_id", g.conf.GithubId)
+	queryParams.Add("redirect_uri", g.conf.GithubRedirectUrl)
 	queryParams.Add("scope", "user")
-	queryParams.Add("state", rand32Str())
+	queryParams.Add("state", state.State)
+	addCodeChallenge(queryParams, state)
 
 	parsedURL.RawQuery = queryParams.Encode()
 
@@ -57,32 +81,68 @@ type GithubTokenResponse struct {
 	ErrorDescription string `json:"error_description"`
 }
 
-func (g *GithubServer) token(code string) (string, error) {
+// ExchangeContext 使用code换取token
+func (g *GithubServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
 	formData := url.Values{}
 	formData.Set("code", code)
-	formData.Set("client_id", config.GithubId)
-	formData.Set("client_secret", config.GithubSecret)
-	formData.Set("redirect_uri", config.GithubRedirectUrl)
+	formData.Set("client_id", g.conf.GithubId)
+	formData.Set("client_secret", g.conf.GithubSecret)
+	formData.Set("redirect_uri", g.conf.GithubRedirectUrl)
+	addCodeVerifier(formData, state)
 
 	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
-	response, err := postBase(GithubTokenPath, formData.Encode(), headers)
+	response, err := postBase(ctx, g.httpClient, GithubTokenPath, formData.Encode(), headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
 	responseStruct := &GithubTokenResponse{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
-		return "", err
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
 	}
 
 	if len(responseStruct.Error) != 0 {
-		return "", errors.New(responseStruct.Error)
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
 	}
 
-	return responseStruct.AccessToken, nil
+	return &Token{
+		AccessToken: responseStruct.AccessToken,
+		TokenType:   responseStruct.TokenType,
+		Scopes:      splitScopes(responseStruct.Scope),
+		Raw:         raw,
+	}, nil
+}
+
+// RevokeContext 撤销应用对该用户的全部授权
+func (g *GithubServer) RevokeContext(ctx context.Context, token string) error {
+	payloadBytes, _ := json.Marshal(map[string]string{"access_token": token})
+	basicAuth := base64.StdEncoding.EncodeToString([]byte(g.conf.GithubId + ":" + g.conf.GithubSecret))
+	headers := map[string]string{
+		"Accept":        "application/vnd.github+json",
+		"Content-Type":  "application/json",
+		"Authorization": "Basic " + basicAuth,
+	}
+	response, err := deleteBase(ctx, g.httpClient, fmt.Sprintf(GithubRevokePath, url.PathEscape(g.conf.GithubId)), string(payloadBytes), headers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	if _, err := readResponse(response); err != nil {
+		return err
+	}
+
+	return newProviderError(response.StatusCode, "", "撤销授权失败")
 }
 
 type GithubUserInfo struct {
@@ -90,17 +150,24 @@ type GithubUserInfo struct {
 	Name      string `json:"name"`
 	Id        int64  `json:"id"`
 	AvatarUrl string `json:"avatar_url"`
+	HtmlUrl   string `json:"html_url"`
+	Email     string `json:"email"`
 	Message   string `json:"message"`
 }
 
-func (g *GithubServer) GetUserinfo(code string) (*Userinfo, error) {
-	token, err := g.token(code)
+func (g *GithubServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := g.ExchangeContext(ctx, code, state)
 	if err != nil {
-		return nil, errors.New("token获取失败:" + err.Error())
+		return nil, fmt.Errorf("token获取失败:%w", err)
 	}
 
-	headers := map[string]string{"Authorization": "Bearer " + token}
-	response, err := getBase(GithubUserInfoPath, headers)
+	return g.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (g *GithubServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	headers := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+	response, err := getBase(ctx, g.httpClient, GithubUserInfoPath, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -109,17 +176,95 @@ func (g *GithubServer) GetUserinfo(code string) (*Userinfo, error) {
 	}()
 
 	responseStruct := &GithubUserInfo{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
 		return nil, err
 	}
 
 	if len(responseStruct.Message) > 0 {
-		return nil, errors.New(responseStruct.Message)
+		return nil, newProviderError(response.StatusCode, "", responseStruct.Message)
 	}
 
-	return &Userinfo{
-		Openid:   strconv.Itoa(int(responseStruct.Id)),
-		NickName: responseStruct.Name,
-		Avatar:   responseStruct.AvatarUrl,
-	}, nil
+	// id缺失时保持openid为空，由【Server】视为失败
+	var openid string
+	if responseStruct.Id > 0 {
+		openid = strconv.FormatInt(responseStruct.Id, 10)
+	}
+
+	userinfo := &Userinfo{
+		Openid:     openid,
+		NickName:   responseStruct.Name,
+		Avatar:     responseStruct.AvatarUrl,
+		Email:      responseStruct.Email,
+		Username:   responseStruct.Login,
+		ProfileURL: responseStruct.HtmlUrl,
+		Raw:        raw,
+	}
+
+	if err := g.fillEmail(ctx, token, userinfo); err != nil {
+		return nil, err
+	}
+
+	return userinfo, nil
+}
+
+type GithubEmail struct {
+	Email      string `json:"email"`
+	Primary    bool   `json:"primary"`
+	Verified   bool   `json:"verified"`
+	Visibility string `json:"visibility"`
+}
+
+// emails 获取账号全部邮箱，/user只返回公开邮箱，设为私密时为空
+func (g *GithubServer) emails(ctx context.Context, token *Token) ([]GithubEmail, error) {
+	headers := map[string]string{"Authorization": "Bearer " + token.AccessToken, "Accept": "application/vnd.github+json"}
+	response, err := getBase(ctx, g.httpClient, GithubEmailsPath, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	content, err := readResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	var emails []GithubEmail
+	if err := json.Unmarshal(content, &emails); err != nil {
+		return nil, err
+	}
+
+	return emails, nil
+}
+
+// fillEmail 使用已验证的主邮箱，配置了GithubRequireVerifiedEmail时没有已验证的主邮箱返回错误
+func (g *GithubServer) fillEmail(ctx context.Context, token *Token, userinfo *Userinfo) error {
+	emails, err := g.emails(ctx, token)
+	if err != nil {
+		if g.conf.GithubRequireVerifiedEmail {
+			return err
+		}
+		return nil
+	}
+
+	for _, email := range emails {
+		if email.Primary && email.Verified {
+			userinfo.Email, userinfo.EmailVerified = email.Email, true
+			return nil
+		}
+	}
+	if g.conf.GithubRequireVerifiedEmail {
+		return &ProviderError{Description: "Github账号没有已验证的主邮箱", Kind: ErrEmailNotVerified}
+	}
+
+	// 没有已验证的主邮箱时保留公开邮箱，公开邮箱已验证时同样标记
+	for _, email := range emails {
+		if email.Email == userinfo.Email {
+			userinfo.EmailVerified = email.Verified
+		}
+	}
+
+	return nil
 }
@@ -1,8 +1,9 @@
 package pkg_login
 
 import (
-	"encoding/json"
-	"errors"
+	"context"
+	"fmt"
+	"net/http"
 	"net/url"
 )
 
@@ -14,8 +15,12 @@ const (
 	GoogleRedirectPath = "https://accounts.google.com/o/oauth2/auth"     // 谷歌获取code地址
 	GoogleTokenPath    = "https://oauth2.googleapis.com/token"           // 谷歌获取token地址
 	GoogleUserInfoPath = "https://www.googleapis.com/oauth2/v2/userinfo" // 谷歌获取用户信息接口
+	GoogleRevokePath   = "https://oauth2.googleapis.com/revoke"          // 谷歌撤销授权接口
+	GoogleJwksPath     = "https://www.googleapis.com/oauth2/v3/certs"    // 谷歌id_token签名公钥
 )
 
+var googleIssuers = []string{"https://accounts.google.com", "accounts.google.com"}
+
 func NewGoogleConf(id, secret, redirectUrl string) *Config {
 	return &Config{
 		GoogleId:          id,
@@ -25,13 +30,31 @@ func NewGoogleConf(id, secret, redirectUrl string) *Config {
 }
 
 type GoogleServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementGoogle, ProviderGoogle, newGoogleProvider)
+}
+
+func newGoogleProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.GoogleId) == 0 || len(p.Config.GoogleSecret) == 0 || len(p.Config.GoogleRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newGoogleServer(p.Config, p.HttpClient), nil
+}
+
+func newGoogleServer(conf *Config, httpClient *http.Client) *GoogleServer {
+	return &GoogleServer{conf: conf, httpClient: httpClient}
 }
 
-func newGoogleServer() *GoogleServer {
-	return &GoogleServer{}
+func (g *GoogleServer) SupportPKCE() bool {
+	return true
 }
 
-func (g *GoogleServer) RedirectUrl() (string, error) {
+func (g *GoogleServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
 	parsedURL, err := url.Parse(GoogleRedirectPath)
 	if err != nil {
 		return "", err
@@ -39,10 +62,15 @@ func (g *GoogleServer) RedirectUrl() (string, error) {
 
 	queryParams := url.Values{}
 	queryParams.Add("response_type", "code")
-	queryParams.Add("client_id", config.GoogleId)
-	queryParams.Add("redirect_uri", config.GoogleRedirectUrl)
-	queryParams.Add("scope", "https://www.googleapis.com/auth/userinfo.profile")
+	queryParams.Add("client_id", g.conf.GoogleId)
+	queryParams.Add("redirect_uri", g.conf.GoogleRedirectUrl)
+	queryParams.Add("scope", "openid email profile")
 	queryParams.Add("access_type", "offline")
+	queryParams.Add("state", state.State)
+	if len(state.Nonce) > 0 {
+		queryParams.Add("nonce", state.Nonce)
+	}
+	addCodeChallenge(queryParams, state)
 
 	parsedURL.RawQuery = queryParams.Encode()
 
@@ -60,52 +88,178 @@ type GoogleTokenResponse struct {
 	IDToken          string `json:"id_token"`
 }
 
-func (g *GoogleServer) token(code string) (string, error) {
+// ExchangeContext 使用code换取token
+func (g *GoogleServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
 	formData := url.Values{}
 	formData.Set("code", code)
-	formData.Set("client_id", config.GoogleId)
-	formData.Set("client_secret", config.GoogleSecret)
-	formData.Set("redirect_uri", config.GoogleRedirectUrl)
+	formData.Set("client_id", g.conf.GoogleId)
+	formData.Set("client_secret", g.conf.GoogleSecret)
+	formData.Set("redirect_uri", g.conf.GoogleRedirectUrl)
 	formData.Set("grant_type", "authorization_code")
+	addCodeVerifier(formData, state)
+
+	token, err := g.tokenRequest(ctx, formData)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce string
+	if state != nil {
+		nonce = state.Nonce
+	}
+	if err := g.verifyToken(ctx, token, nonce); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RefreshContext 使用refresh_token刷新token
+func (g *GoogleServer) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("client_id", g.conf.GoogleId)
+	formData.Set("client_secret", g.conf.GoogleSecret)
+	formData.Set("grant_type", "refresh_token")
+
+	token, err := g.tokenRequest(ctx, formData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 刷新返回的id_token不携带nonce
+	if err := g.verifyToken(ctx, token, ""); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// verifyToken 存在id_token时校验并填充token.Claims
+func (g *GoogleServer) verifyToken(ctx context.Context, token *Token, nonce string) error {
+	if len(token.IDToken) == 0 {
+		return nil
+	}
+
+	claims, err := g.VerifyIDTokenContext(ctx, token.IDToken, nonce)
+	if err != nil {
+		return err
+	}
+	token.Claims = claims
+
+	return nil
+}
+
+// VerifyIDTokenContext 校验id_token签名、iss、aud、exp及nonce，nonce为空时不校验nonce
+func (g *GoogleServer) VerifyIDTokenContext(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error) {
+	return verifyIDToken(ctx, g.httpClient, idToken, idTokenVerify{
+		JwksUrl:  GoogleJwksPath,
+		Issuers:  googleIssuers,
+		ClientId: g.conf.GoogleId,
+		Nonce:    nonce,
+	})
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (g *GoogleServer) tokenRequest(ctx context.Context, formData url.Values) (*Token, error) {
 	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
-	response, err := postBase(GoogleTokenPath, formData.Encode(), headers)
+	response, err := postBase(ctx, g.httpClient, GoogleTokenPath, formData.Encode(), headers)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 	defer func() {
 		_ = response.Body.Close()
 	}()
 
 	responseStruct := &GoogleTokenResponse{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
-		return "", err
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(responseStruct.ErrorDescription) != 0 {
-		return "", errors.New(responseStruct.ErrorDescription)
+	if len(responseStruct.Error) != 0 {
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
 	}
 
-	return responseStruct.AccessToken, nil
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		TokenType:    responseStruct.TokenType,
+		Expiry:       expiryIn(int64(responseStruct.ExpiresIn)),
+		Scopes:       splitScopes(responseStruct.Scope),
+		IDToken:      responseStruct.IDToken,
+		Raw:          raw,
+	}, nil
+}
+
+// RevokeContext 撤销授权，access_token及refresh_token均可
+func (g *GoogleServer) RevokeContext(ctx context.Context, token string) error {
+	formData := url.Values{}
+	formData.Set("token", token)
+
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	response, err := postBase(ctx, g.httpClient, GoogleRevokePath, formData.Encode(), headers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	if _, err := readResponse(response); err != nil {
+		return err
+	}
+
+	return newProviderError(response.StatusCode, "", "撤销授权失败")
 }
 
 type GoogleUserInfo struct {
-	Id      string `json:"id"`
-	Name    string `json:"name"`
-	Picture string `json:"picture"`
-	Error   struct {
+	Id            string `json:"id"`
+	Name          string `json:"name"`
+	Picture       string `json:"picture"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	Locale        string `json:"locale"`
+	Error         struct {
 		Code    int64  `json:"code"`
 		Message string `json:"message"`
 	} `json:"error"`
 }
 
-func (g *GoogleServer) GetUserinfo(code string) (*Userinfo, error) {
-	token, err := g.token(code)
+func (g *GoogleServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := g.ExchangeContext(ctx, code, state)
 	if err != nil {
-		return nil, errors.New("token获取失败:" + err.Error())
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return g.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (g *GoogleServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	// 不信任调用方传入的token.Claims，重新校验id_token，校验通过时省去一次用户信息接口请求；
+	// id_token已过期等校验失败时改用用户信息接口
+	if len(token.IDToken) > 0 {
+		if claims, err := g.VerifyIDTokenContext(ctx, token.IDToken, ""); err == nil {
+			locale, _ := claims.Raw["locale"].(string)
+			return &Userinfo{
+				Openid:        claims.Subject,
+				NickName:      claims.Name,
+				Avatar:        claims.Picture,
+				Email:         claims.Email,
+				EmailVerified: claims.EmailVerified,
+				Locale:        locale,
+				Raw:           claims.Raw,
+			}, nil
+		}
 	}
 
-	headers := map[string]string{"Authorization": "Bearer " + token}
-	response, err := getBase(GoogleUserInfoPath, headers)
+	headers := map[string]string{"Authorization": "Bearer " + token.AccessToken}
+	response, err := getBase(ctx, g.httpClient, GoogleUserInfoPath, headers)
 	if err != nil {
 		return nil, err
 	}
@@ -114,17 +268,22 @@ func (g *GoogleServer) GetUserinfo(code string) (*Userinfo, error) {
 	}()
 
 	responseStruct := &GoogleUserInfo{}
-	if err := json.NewDecoder(response.Body).Decode(responseStruct); err != nil {
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
 		return nil, err
 	}
 
 	if responseStruct.Error.Code != 0 {
-		return nil, errors.New(responseStruct.Error.Message)
+		return nil, newProviderError(response.StatusCode, "", responseStruct.Error.Message)
 	}
 
 	return &Userinfo{
-		Openid:   responseStruct.Id,
-		NickName: responseStruct.Name,
-		Avatar:   responseStruct.Picture,
+		Openid:        responseStruct.Id,
+		NickName:      responseStruct.Name,
+		Avatar:        responseStruct.Picture,
+		Email:         responseStruct.Email,
+		EmailVerified: responseStruct.VerifiedEmail,
+		Locale:        responseStruct.Locale,
+		Raw:           raw,
 	}, nil
 }
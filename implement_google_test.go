@@ -0,0 +1,68 @@
+package pkg_login
+
+import (
+	"context"
+	"crypto/rsa"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGoogleUserinfoIgnoresCallerClaims(t *testing.T) {
+	key := newTestRsaKey(t)
+	jwks := newTestJwksServer(t, map[string]*rsa.PublicKey{"google-k1": &key.PublicKey})
+
+	userinfoHits := &atomic.Int32{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/oauth2/v3/certs" {
+			jwks.Config.Handler.ServeHTTP(w, r)
+			return
+		}
+		userinfoHits.Add(1)
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"id":"10001","email":"user@example.com","verified_email":true}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	target, _ := url.Parse(upstream.URL)
+	server := newGoogleServer(NewGoogleConf(testClientId, "secret", "https://example.com/callback"), &http.Client{Transport: rewriteTransport{target: target}})
+
+	googleClaims := func(exp time.Time) map[string]any {
+		claims := validTestClaims()
+		claims["iss"] = googleIssuers[0]
+		claims["exp"] = exp.Unix()
+		return claims
+	}
+	forged := &IDTokenClaims{Subject: "attacker", Email: "admin@example.com", EmailVerified: true}
+
+	tests := []struct {
+		name       string
+		idToken    string
+		wantOpenid string
+		wantHits   int32
+	}{
+		{name: "无id_token时使用用户信息接口", wantOpenid: "10001", wantHits: 1},
+		{name: "使用重新校验的id_token声明", idToken: signTestIDToken(t, key, "RS256", "google-k1", googleClaims(time.Now().Add(time.Hour))), wantOpenid: "10001"},
+		{name: "id_token已过期时使用用户信息接口", idToken: signTestIDToken(t, key, "RS256", "google-k1", googleClaims(time.Now().Add(-idTokenLeeway-time.Minute))), wantOpenid: "10001", wantHits: 1},
+		{name: "伪造id_token时使用用户信息接口", idToken: signTestIDToken(t, newTestRsaKey(t), "RS256", "google-k1", googleClaims(time.Now().Add(time.Hour))), wantOpenid: "10001", wantHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			userinfoHits.Store(0)
+			userinfo, err := server.GetUserinfoWithTokenContext(context.Background(), &Token{AccessToken: "access", IDToken: tt.idToken, Claims: forged})
+			if err != nil {
+				t.Fatalf("获取账户信息失败: %v", err)
+			}
+			if userinfo.Openid != tt.wantOpenid || userinfo.Email != "user@example.com" {
+				t.Fatalf("不应使用调用方传入的Claims，实际: %+v", userinfo)
+			}
+			if got := userinfoHits.Load(); got != tt.wantHits {
+				t.Fatalf("期望请求用户信息接口%d次，实际%d次", tt.wantHits, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,305 @@
+package pkg_login
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+/**
+ * Doc : https://datatracker.ietf.org/doc/html/rfc6749
+ */
+
+const (
+	OAuth2BodyForm    = "form"   // token接口使用表单提交（默认）
+	OAuth2BodyJson    = "json"   // token接口使用json提交
+	OAuth2AuthBody    = "body"   // client_id、client_secret放在请求体中（默认）
+	OAuth2AuthBasic   = "basic"  // client_id、client_secret使用basic认证
+	OAuth2TokenHeader = "header" // 用户信息接口通过Authorization头传递token（默认）
+	OAuth2TokenQuery  = "query"  // 用户信息接口通过url参数传递token
+)
+
+// OAuth2Config 通用OAuth2服务商配置，字段映射使用以.分隔的路径，如 data.user.id、data.list.0.name
+type OAuth2Config struct {
+	ClientId        string            `json:"client_id"`
+	ClientSecret    string            `json:"client_secret"`
+	RedirectUrl     string            `json:"redirect_url"`
+	AuthorizeUrl    string            `json:"authorize_url"`
+	TokenUrl        string            `json:"token_url"`
+	UserinfoUrl     string            `json:"userinfo_url"`
+	Scopes          []string          `json:"scopes"`
+	ScopeSeparator  string            `json:"scope_separator"`  // 默认空格
+	AuthorizeParams map[string]string `json:"authorize_params"` // 授权地址附加参数
+	PKCE            bool              `json:"pkce"`
+	TokenBody       string            `json:"token_body"`  // form 或 json，默认 form
+	ClientAuth      string            `json:"client_auth"` // body 或 basic，默认 body
+	TokenStyle      string            `json:"token_style"` // header 或 query，默认 header
+	TokenParam      string            `json:"token_param"` // token_style为query时的参数名，默认 access_token
+	TokenPrefix     string            `json:"token_prefix"`
+	TokenFields     OAuth2TokenFields `json:"token_fields"`
+	UserFields      OAuth2UserFields  `json:"user_fields"`
+}
+
+// OAuth2TokenFields token响应字段映射，为空时使用RFC 6749标准字段名
+type OAuth2TokenFields struct {
+	AccessToken      string `json:"access_token"`
+	RefreshToken     string `json:"refresh_token"`
+	ExpiresIn        string `json:"expires_in"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// OAuth2UserFields 用户信息响应字段映射，openid为必填
+type OAuth2UserFields struct {
+	Openid           string `json:"openid"`
+	UnionId          string `json:"union_id"`
+	NickName         string `json:"nick_name"`
+	Avatar           string `json:"avatar"`
+	Mobile           string `json:"mobile"`
+	Email            string `json:"email"`
+	EmailVerified    string `json:"email_verified"`
+	Username         string `json:"username"`
+	ProfileURL       string `json:"profile_url"`
+	Locale           string `json:"locale"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// NewOAuth2Conf name为【NewServerByName】使用的名称，也可直接在json配置的oauth2节点中声明
+func NewOAuth2Conf(name string, conf *OAuth2Config) *Config {
+	return &Config{
+		OAuth2: map[string]*OAuth2Config{name: conf},
+	}
+}
+
+// OAuth2Provider 通用OAuth2服务商构造方法，读取Config.OAuth2中与注册名同名的配置；
+// 【NewServerByName】对未注册的名称自动使用，无需调用【RegisterProvider】
+func OAuth2Provider(p ProviderConfig) (Ability, error) {
+	conf := p.Config.OAuth2[p.Name]
+	if conf == nil || len(conf.ClientId) == 0 || len(conf.RedirectUrl) == 0 || len(conf.AuthorizeUrl) == 0 ||
+		len(conf.TokenUrl) == 0 || len(conf.UserinfoUrl) == 0 || len(conf.UserFields.Openid) == 0 {
+		return nil, ErrNotConfigured
+	}
+	if conf.TokenBody != "" && conf.TokenBody != OAuth2BodyForm && conf.TokenBody != OAuth2BodyJson {
+		return nil, fmt.Errorf("%w:token_body仅支持form、json", ErrNotConfigured)
+	}
+	if conf.ClientAuth != "" && conf.ClientAuth != OAuth2AuthBody && conf.ClientAuth != OAuth2AuthBasic {
+		return nil, fmt.Errorf("%w:client_auth仅支持body、basic", ErrNotConfigured)
+	}
+	if conf.TokenStyle != "" && conf.TokenStyle != OAuth2TokenHeader && conf.TokenStyle != OAuth2TokenQuery {
+		return nil, fmt.Errorf("%w:token_style仅支持header、query", ErrNotConfigured)
+	}
+
+	return newOAuth2Server(conf, p.HttpClient), nil
+}
+
+type OAuth2Server struct {
+	conf       *OAuth2Config
+	httpClient *http.Client
+}
+
+func newOAuth2Server(conf *OAuth2Config, httpClient *http.Client) *OAuth2Server {
+	return &OAuth2Server{conf: conf, httpClient: httpClient}
+}
+
+func (o *OAuth2Server) SupportPKCE() bool {
+	return o.conf.PKCE
+}
+
+func (o *OAuth2Server) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(o.conf.AuthorizeUrl)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := parsedURL.Query()
+	queryParams.Add("response_type", "code")
+	queryParams.Add("client_id", o.conf.ClientId)
+	queryParams.Add("redirect_uri", o.conf.RedirectUrl)
+	if len(o.conf.Scopes) > 0 {
+		separator := o.conf.ScopeSeparator
+		if len(separator) == 0 {
+			separator = " "
+		}
+		queryParams.Add("scope", strings.Join(o.conf.Scopes, separator))
+	}
+	queryParams.Add("state", state.State)
+	for key, val := range o.conf.AuthorizeParams {
+		queryParams.Set(key, val)
+	}
+	addCodeChallenge(queryParams, state)
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+// ExchangeContext 使用code换取token
+func (o *OAuth2Server) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("code", code)
+	formData.Set("redirect_uri", o.conf.RedirectUrl)
+	formData.Set("grant_type", "authorization_code")
+	addCodeVerifier(formData, state)
+
+	return o.tokenRequest(ctx, formData)
+}
+
+// RefreshContext 使用refresh_token刷新token
+func (o *OAuth2Server) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("grant_type", "refresh_token")
+
+	return o.tokenRequest(ctx, formData)
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (o *OAuth2Server) tokenRequest(ctx context.Context, formData url.Values) (*Token, error) {
+	headers := map[string]string{"Accept": "application/json"}
+	if o.conf.ClientAuth == OAuth2AuthBasic {
+		credential := url.QueryEscape(o.conf.ClientId) + ":" + url.QueryEscape(o.conf.ClientSecret)
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))
+	} else {
+		formData.Set("client_id", o.conf.ClientId)
+		formData.Set("client_secret", o.conf.ClientSecret)
+	}
+
+	var payload string
+	if o.conf.TokenBody == OAuth2BodyJson {
+		fields := make(map[string]string, len(formData))
+		for key := range formData {
+			fields[key] = formData.Get(key)
+		}
+		body, err := json.Marshal(fields)
+		if err != nil {
+			return nil, err
+		}
+		payload = string(body)
+		headers["Content-Type"] = "application/json"
+	} else {
+		payload = formData.Encode()
+		headers["Content-Type"] = "application/x-www-form-urlencoded"
+	}
+
+	response, err := postBase(ctx, o.httpClient, o.conf.TokenUrl, payload, headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	raw, err := decodeResponse(response, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := o.conf.TokenFields
+	accessToken := lookupString(raw, fieldOr(fields.AccessToken, "access_token"))
+	if len(accessToken) == 0 {
+		if err := mappedError(response.StatusCode, raw, fieldOr(fields.Error, "error"), fieldOr(fields.ErrorDescription, "error_description")); err != nil {
+			return nil, err
+		}
+		return nil, invalidResponse("token响应缺失access_token")
+	}
+
+	expiresIn, _ := strconv.ParseInt(lookupString(raw, fieldOr(fields.ExpiresIn, "expires_in")), 10, 64)
+
+	return &Token{
+		AccessToken:  accessToken,
+		RefreshToken: lookupString(raw, fieldOr(fields.RefreshToken, "refresh_token")),
+		TokenType:    lookupString(raw, "token_type"),
+		Expiry:       expiryIn(expiresIn),
+		Scopes:       splitScopes(lookupString(raw, fieldOr(fields.Scope, "scope"))),
+		Raw:          raw,
+	}, nil
+}
+
+func (o *OAuth2Server) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := o.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return o.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息，按user_fields映射字段
+func (o *OAuth2Server) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	parsedURL, err := url.Parse(o.conf.UserinfoUrl)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{"Accept": "application/json"}
+	if o.conf.TokenStyle == OAuth2TokenQuery {
+		queryParams := parsedURL.Query()
+		queryParams.Set(fieldOr(o.conf.TokenParam, "access_token"), token.AccessToken)
+		parsedURL.RawQuery = queryParams.Encode()
+	} else {
+		headers["Authorization"] = fieldOr(o.conf.TokenPrefix, "Bearer") + " " + token.AccessToken
+	}
+
+	response, err := getBase(ctx, o.httpClient, parsedURL.String(), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	raw, err := decodeResponse(response, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := o.conf.UserFields
+	openid := lookupString(raw, fields.Openid)
+	if len(openid) == 0 {
+		if err := mappedError(response.StatusCode, raw, fieldOr(fields.Error, "error"), fieldOr(fields.ErrorDescription, "error_description")); err != nil {
+			return nil, err
+		}
+		return nil, invalidResponse("用户信息缺失openid")
+	}
+
+	emailVerified, _ := strconv.ParseBool(lookupString(raw, fields.EmailVerified))
+
+	return &Userinfo{
+		Openid:        openid,
+		UnionId:       lookupString(raw, fields.UnionId),
+		NickName:      lookupString(raw, fields.NickName),
+		Avatar:        lookupString(raw, fields.Avatar),
+		Mobile:        lookupString(raw, fields.Mobile),
+		Email:         lookupString(raw, fields.Email),
+		EmailVerified: emailVerified,
+		Username:      lookupString(raw, fields.Username),
+		ProfileURL:    lookupString(raw, fields.ProfileURL),
+		Locale:        lookupString(raw, fields.Locale),
+		Raw:           raw,
+	}, nil
+}
+
+func fieldOr(field, fallback string) string {
+	if len(field) == 0 {
+		return fallback
+	}
+
+	return field
+}
+
+// mappedError 按映射路径读取错误码及描述，错误码为空或为0时返回nil
+func mappedError(httpStatus int, raw map[string]any, errorPath, descriptionPath string) error {
+	code := lookupString(raw, errorPath)
+	if len(code) == 0 || code == "0" {
+		return nil
+	}
+
+	return newProviderError(httpStatus, code, lookupString(raw, descriptionPath))
+}
@@ -0,0 +1,85 @@
+package pkg_login
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+func TestMappedError(t *testing.T) {
+	tests := []struct {
+		name            string
+		raw             map[string]any
+		errorPath       string
+		descriptionPath string
+		wantCode        string
+		wantDesc        string
+	}{
+		{name: "无错误", raw: map[string]any{"access_token": "token"}, errorPath: "error", descriptionPath: "error_description"},
+		{name: "未配置错误字段", raw: map[string]any{"error": "invalid_grant"}},
+		{name: "错误码为0", raw: map[string]any{"code": json.Number("0"), "msg": "success"}, errorPath: "code", descriptionPath: "msg"},
+		{name: "字符串错误码", raw: map[string]any{"error": "invalid_grant", "error_description": "code已使用"}, errorPath: "error", descriptionPath: "error_description", wantCode: "invalid_grant", wantDesc: "code已使用"},
+		{name: "数字错误码", raw: map[string]any{"code": json.Number("40029"), "msg": "invalid code"}, errorPath: "code", descriptionPath: "msg", wantCode: "40029", wantDesc: "invalid code"},
+		{name: "嵌套错误", raw: map[string]any{"data": map[string]any{"err": map[string]any{"code": "expired", "msg": "已过期"}}}, errorPath: "data.err.code", descriptionPath: "data.err.msg", wantCode: "expired", wantDesc: "已过期"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := mappedError(http.StatusOK, tt.raw, tt.errorPath, tt.descriptionPath)
+			if len(tt.wantCode) == 0 {
+				if err != nil {
+					t.Fatalf("期望无错误，实际: %v", err)
+				}
+				return
+			}
+
+			var providerErr *ProviderError
+			if !errors.As(err, &providerErr) || providerErr.Code != tt.wantCode || providerErr.Description != tt.wantDesc {
+				t.Fatalf("期望错误%s(%s)，实际: %v", tt.wantCode, tt.wantDesc, err)
+			}
+		})
+	}
+}
+
+func TestNewServerByNameFromConfig(t *testing.T) {
+	conf := NewOAuth2Conf("niche", &OAuth2Config{
+		ClientId:     "client_id",
+		RedirectUrl:  "https://example.com/callback",
+		AuthorizeUrl: "https://niche.example.com/oauth/authorize",
+		TokenUrl:     "https://niche.example.com/oauth/token",
+		UserinfoUrl:  "https://niche.example.com/api/user",
+		UserFields:   OAuth2UserFields{Openid: "data.user.id"},
+	})
+	conf.OIDC = NewOIDCConf("keycloak", "https://sso.example.com/realms/master", "client_id", "client_secret", "https://example.com/callback").OIDC
+	client := NewClient(conf)
+
+	tests := []struct {
+		name     string
+		wantImpl string
+		wantErr  error
+	}{
+		{name: "niche", wantImpl: "*pkg_login.OAuth2Server"},
+		{name: "keycloak", wantImpl: "*pkg_login.OIDCServer"},
+		{name: "unknown", wantErr: ErrUnknownProvider},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, err := client.NewServerByName(tt.name)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("期望%v，实际: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("未注册的配置服务商创建失败: %v", err)
+			}
+			if impl := fmt.Sprintf("%T", server.client); impl != tt.wantImpl || server.Provider != tt.name {
+				t.Fatalf("期望%s实现，实际: %s %s", tt.wantImpl, impl, server.Provider)
+			}
+		})
+	}
+}
@@ -0,0 +1,438 @@
+package pkg_login
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/**
+ * Doc : https://openid.net/specs/openid-connect-core-1_0.html
+ * Doc : https://openid.net/specs/openid-connect-discovery-1_0.html
+ */
+
+const (
+	OIDCDiscoveryPath    = "/.well-known/openid-configuration" // 服务发现地址，拼接在issuer之后
+	oidcDiscoveryMaxAge  = time.Hour                           // 服务发现文档缓存时间
+	oidcDefaultScopeList = "openid profile email"              // 未配置scope时的默认授权范围
+)
+
+// OIDCConfig 通用OpenID Connect服务商配置，可对接Keycloak、Authing、Casdoor、Okta等
+type OIDCConfig struct {
+	Issuer       string   `json:"issuer"` // 如 https://sso.example.com/realms/master
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	RedirectUrl  string   `json:"redirect_url"`
+	Scopes       []string `json:"scopes"` // 为空时使用 openid profile email
+}
+
+// NewOIDCConf name为【NewServerByName】使用的名称
+func NewOIDCConf(name, issuer, id, secret, redirectUrl string) *Config {
+	return &Config{
+		OIDC: map[string]*OIDCConfig{
+			name: {
+				Issuer:       issuer,
+				ClientId:     id,
+				ClientSecret: secret,
+				RedirectUrl:  redirectUrl,
+			},
+		},
+	}
+}
+
+// OIDCProvider 通用OpenID Connect服务商构造方法，读取Config.OIDC中与注册名同名的配置；
+// 【NewServerByName】对未注册的名称自动使用，无需调用【RegisterProvider】
+func OIDCProvider(p ProviderConfig) (Ability, error) {
+	conf := p.Config.OIDC[p.Name]
+	if conf == nil || len(conf.Issuer) == 0 || len(conf.ClientId) == 0 || len(conf.RedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newOIDCServer(conf, p.HttpClient), nil
+}
+
+type OIDCServer struct {
+	conf       *OIDCConfig
+	httpClient *http.Client
+}
+
+func newOIDCServer(conf *OIDCConfig, httpClient *http.Client) *OIDCServer {
+	return &OIDCServer{conf: conf, httpClient: httpClient}
+}
+
+func (o *OIDCServer) SupportPKCE() bool {
+	return true
+}
+
+// OIDCDiscovery 服务发现文档
+type OIDCDiscovery struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JwksUri                           string   `json:"jwks_uri"`
+	RevocationEndpoint                string   `json:"revocation_endpoint"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+}
+
+type oidcDiscoveryCache struct {
+	mu       sync.Mutex
+	doc      *OIDCDiscovery
+	expireAt time.Time
+}
+
+var oidcDiscoveryCaches sync.Map // issuer => *oidcDiscoveryCache
+
+// discovery 获取服务发现文档，按issuer进程内缓存
+func (o *OIDCServer) discovery(ctx context.Context) (*OIDCDiscovery, error) {
+	issuer := strings.TrimSuffix(o.conf.Issuer, "/")
+	value, _ := oidcDiscoveryCaches.LoadOrStore(issuer, &oidcDiscoveryCache{})
+	cache := value.(*oidcDiscoveryCache)
+
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	if cache.doc != nil && time.Now().Before(cache.expireAt) {
+		return cache.doc, nil
+	}
+
+	response, err := getBase(ctx, o.httpClient, issuer+OIDCDiscoveryPath, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return nil, fmt.Errorf("服务发现失败:%w", err)
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	doc := &OIDCDiscovery{}
+	if _, err := decodeResponse(response, doc); err != nil {
+		return nil, fmt.Errorf("服务发现失败:%w", err)
+	}
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, invalidResponse("服务发现issuer不匹配:" + doc.Issuer)
+	}
+	if len(doc.AuthorizationEndpoint) == 0 || len(doc.TokenEndpoint) == 0 || len(doc.JwksUri) == 0 {
+		return nil, invalidResponse("服务发现文档缺失必要地址")
+	}
+
+	cache.doc = doc
+	cache.expireAt = time.Now().Add(oidcDiscoveryMaxAge)
+
+	return doc, nil
+}
+
+func (o *OIDCServer) scope() string {
+	if len(o.conf.Scopes) == 0 {
+		return oidcDefaultScopeList
+	}
+	if !slices.Contains(o.conf.Scopes, "openid") {
+		return "openid " + strings.Join(o.conf.Scopes, " ")
+	}
+
+	return strings.Join(o.conf.Scopes, " ")
+}
+
+func (o *OIDCServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	parsedURL, err := url.Parse(doc.AuthorizationEndpoint)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := parsedURL.Query()
+	queryParams.Add("response_type", "code")
+	queryParams.Add("client_id", o.conf.ClientId)
+	queryParams.Add("redirect_uri", o.conf.RedirectUrl)
+	queryParams.Add("scope", o.scope())
+	queryParams.Add("state", state.State)
+	queryParams.Add("nonce", state.Nonce)
+	addCodeChallenge(queryParams, state)
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+// OIDCTokenResponse 标准token响应（RFC 6749 5.1、5.2）
+type OIDCTokenResponse struct {
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token"`
+	Scope            string `json:"scope"`
+	IDToken          string `json:"id_token"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// clientAuth 服务商支持client_secret_basic时使用basic认证，否则将client_secret放在表单中
+func (o *OIDCServer) clientAuth(doc *OIDCDiscovery, formData url.Values, headers map[string]string) {
+	if len(o.conf.ClientSecret) > 0 && slices.Contains(doc.TokenEndpointAuthMethodsSupported, "client_secret_basic") {
+		credential := url.QueryEscape(o.conf.ClientId) + ":" + url.QueryEscape(o.conf.ClientSecret)
+		headers["Authorization"] = "Basic " + base64.StdEncoding.EncodeToString([]byte(credential))
+		return
+	}
+
+	formData.Set("client_id", o.conf.ClientId)
+	if len(o.conf.ClientSecret) > 0 {
+		formData.Set("client_secret", o.conf.ClientSecret)
+	}
+}
+
+// ExchangeContext 使用code换取token并校验id_token
+func (o *OIDCServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("code", code)
+	formData.Set("redirect_uri", o.conf.RedirectUrl)
+	formData.Set("grant_type", "authorization_code")
+	addCodeVerifier(formData, state)
+
+	token, err := o.tokenRequest(ctx, formData)
+	if err != nil {
+		return nil, err
+	}
+	if len(token.IDToken) == 0 {
+		return nil, invalidResponse("token响应缺失id_token")
+	}
+
+	var nonce string
+	if state != nil {
+		nonce = state.Nonce
+	}
+	if token.Claims, err = o.VerifyIDTokenContext(ctx, token.IDToken, nonce); err != nil {
+		return nil, err
+	}
+
+	return token, nil
+}
+
+// RefreshContext 使用refresh_token刷新token
+func (o *OIDCServer) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("refresh_token", refreshToken)
+	formData.Set("grant_type", "refresh_token")
+
+	token, err := o.tokenRequest(ctx, formData)
+	if err != nil {
+		return nil, err
+	}
+
+	// 刷新返回的id_token不携带nonce
+	if len(token.IDToken) > 0 {
+		if token.Claims, err = o.VerifyIDTokenContext(ctx, token.IDToken, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return token, nil
+}
+
+// tokenRequest 请求token接口，code换取及刷新共用
+func (o *OIDCServer) tokenRequest(ctx context.Context, formData url.Values) (*Token, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
+	o.clientAuth(doc, formData, headers)
+	response, err := postBase(ctx, o.httpClient, doc.TokenEndpoint, formData.Encode(), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &OIDCTokenResponse{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responseStruct.Error) != 0 {
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
+	}
+
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		TokenType:    responseStruct.TokenType,
+		Expiry:       expiryIn(responseStruct.ExpiresIn),
+		Scopes:       splitScopes(responseStruct.Scope),
+		IDToken:      responseStruct.IDToken,
+		Raw:          raw,
+	}, nil
+}
+
+// VerifyIDTokenContext 使用服务发现的jwks校验id_token，nonce为空时不校验nonce
+func (o *OIDCServer) VerifyIDTokenContext(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error) {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return verifyIDToken(ctx, o.httpClient, idToken, idTokenVerify{
+		JwksUrl:  doc.JwksUri,
+		Issuers:  []string{doc.Issuer},
+		ClientId: o.conf.ClientId,
+		Nonce:    nonce,
+	})
+}
+
+// RevokeContext 撤销授权（RFC 7009），服务发现文档未提供撤销地址时返回【ErrNotSupported】
+func (o *OIDCServer) RevokeContext(ctx context.Context, token string) error {
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return err
+	}
+	if len(doc.RevocationEndpoint) == 0 {
+		return ErrNotSupported
+	}
+
+	formData := url.Values{}
+	formData.Set("token", token)
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	o.clientAuth(doc, formData, headers)
+	response, err := postBase(ctx, o.httpClient, doc.RevocationEndpoint, formData.Encode(), headers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	if response.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	if _, err := readResponse(response); err != nil {
+		return err
+	}
+
+	return newProviderError(response.StatusCode, "", "撤销授权失败")
+}
+
+// OIDCUserInfo 标准声明（OpenID Connect Core 5.1）
+type OIDCUserInfo struct {
+	Sub               string `json:"sub"`
+	Name              string `json:"name"`
+	PreferredUsername string `json:"preferred_username"`
+	Nickname          string `json:"nickname"`
+	Picture           string `json:"picture"`
+	Profile           string `json:"profile"`
+	Email             string `json:"email"`
+	EmailVerified     any    `json:"email_verified"` // 部分服务商返回字符串
+	PhoneNumber       string `json:"phone_number"`
+	Locale            string `json:"locale"`
+	Error             string `json:"error"`
+	ErrorDescription  string `json:"error_description"`
+}
+
+func (o *OIDCServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := o.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return o.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 服务商提供userinfo接口时以接口返回为准，否则使用id_token声明
+func (o *OIDCServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	// 不信任调用方传入的token.Claims，重新校验id_token；id_token已过期等校验失败时以userinfo接口为准
+	var claims *IDTokenClaims
+	var claimsErr error
+	if len(token.IDToken) > 0 {
+		claims, claimsErr = o.VerifyIDTokenContext(ctx, token.IDToken, "")
+	}
+
+	responseStruct := &OIDCUserInfo{}
+	var raw map[string]any
+	if claims != nil {
+		raw = claims.Raw
+		responseStruct.Sub = claims.Subject
+		responseStruct.Name = claims.Name
+		responseStruct.Picture = claims.Picture
+		responseStruct.Email = claims.Email
+		responseStruct.EmailVerified = claims.EmailVerified
+		responseStruct.PreferredUsername, _ = raw["preferred_username"].(string)
+		responseStruct.Nickname, _ = raw["nickname"].(string)
+		responseStruct.Profile, _ = raw["profile"].(string)
+		responseStruct.PhoneNumber, _ = raw["phone_number"].(string)
+		responseStruct.Locale, _ = raw["locale"].(string)
+	}
+
+	doc, err := o.discovery(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if len(doc.UserinfoEndpoint) == 0 && claims == nil {
+		if claimsErr != nil {
+			return nil, claimsErr
+		}
+		return nil, invalidResponse("token缺失id_token且服务商未提供userinfo接口")
+	}
+	if len(doc.UserinfoEndpoint) > 0 {
+		headers := map[string]string{"Accept": "application/json", "Authorization": "Bearer " + token.AccessToken}
+		response, err := getBase(ctx, o.httpClient, doc.UserinfoEndpoint, headers)
+		if err != nil {
+			return nil, err
+		}
+		defer func() {
+			_ = response.Body.Close()
+		}()
+
+		claimsSub := responseStruct.Sub
+		if raw, err = decodeResponse(response, responseStruct); err != nil {
+			return nil, err
+		}
+		if len(responseStruct.Error) > 0 {
+			return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
+		}
+		// userinfo的sub必须与id_token一致，防止token替换（OpenID Connect Core 5.3.2）
+		if len(claimsSub) > 0 && responseStruct.Sub != claimsSub {
+			return nil, &ProviderError{Description: "userinfo sub与id_token不一致", Kind: ErrInvalidToken}
+		}
+	}
+
+	nickName := responseStruct.Name
+	if len(nickName) == 0 {
+		nickName = responseStruct.Nickname
+	}
+	if len(nickName) == 0 {
+		nickName = responseStruct.PreferredUsername
+	}
+
+	var emailVerified bool
+	switch verified := responseStruct.EmailVerified.(type) {
+	case bool:
+		emailVerified = verified
+	case string:
+		emailVerified, _ = strconv.ParseBool(verified)
+	}
+
+	return &Userinfo{
+		Openid:        responseStruct.Sub,
+		NickName:      nickName,
+		Avatar:        responseStruct.Picture,
+		Mobile:        responseStruct.PhoneNumber,
+		Email:         responseStruct.Email,
+		EmailVerified: emailVerified,
+		Username:      responseStruct.PreferredUsername,
+		ProfileURL:    responseStruct.Profile,
+		Locale:        responseStruct.Locale,
+		Raw:           raw,
+	}, nil
+}
@@ -0,0 +1,293 @@
+package pkg_login
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/**
+ * Doc : https://wiki.connect.qq.com/%E5%87%86%E5%A4%87%E5%B7%A5%E4%BD%9C_oauth2-0
+ */
+
+const (
+	QqRedirectPath = "https://graph.qq.com/oauth2.0/authorize" // QQ获取code地址
+	QqTokenPath    = "https://graph.qq.com/oauth2.0/token"     // QQ获取token地址
+	QqOpenIdPath   = "https://graph.qq.com/oauth2.0/me"        // QQ获取openid地址
+	QqUserInfoPath = "https://graph.qq.com/user/get_user_info" // QQ获取用户信息接口
+)
+
+func NewQqConf(id, secret, redirectUrl string) *Config {
+	return &Config{
+		QqId:          id,
+		QqSecret:      secret,
+		QqRedirectUrl: redirectUrl,
+	}
+}
+
+type QqServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementQq, ProviderQq, newQqProvider)
+}
+
+func newQqProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.QqId) == 0 || len(p.Config.QqSecret) == 0 || len(p.Config.QqRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newQqServer(p.Config, p.HttpClient), nil
+}
+
+func newQqServer(conf *Config, httpClient *http.Client) *QqServer {
+	return &QqServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE QQ互联不支持PKCE
+func (q *QqServer) SupportPKCE() bool {
+	return false
+}
+
+func (q *QqServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(QqRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("response_type", "code")
+	queryParams.Add("client_id", q.conf.QqId)
+	queryParams.Add("redirect_uri", q.conf.QqRedirectUrl)
+	queryParams.Add("scope", "get_user_info")
+	queryParams.Add("state", state.State)
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+// qqDecode 解析QQ互联响应，兼容json、callback( {...} );包裹的jsonp以及a=1&b=2表单格式，同时返回原始字段
+func qqDecode(response *http.Response, v any) (map[string]any, error) {
+	content, err := readBody(response)
+	if err != nil {
+		return nil, err
+	}
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		if json.Valid(content) {
+			return nil, statusError(response.StatusCode, content)
+		}
+		return nil, &ProviderError{HTTPStatus: response.StatusCode, Description: "非json响应:" + bodySnippet(content)}
+	}
+
+	content = bytes.TrimSpace(content)
+	if bytes.HasPrefix(content, []byte("callback")) {
+		start, end := bytes.IndexByte(content, '('), bytes.LastIndexByte(content, ')')
+		if start < 0 || end <= start {
+			return nil, invalidResponse("响应格式错误:" + bodySnippet(content))
+		}
+		content = bytes.TrimSpace(content[start+1 : end])
+	}
+
+	if !bytes.HasPrefix(content, []byte("{")) {
+		values, err := url.ParseQuery(string(content))
+		if err != nil || !bytes.Contains(content, []byte("=")) {
+			return nil, invalidResponse("响应格式错误:" + bodySnippet(content))
+		}
+		fields := make(map[string]string, len(values))
+		for key := range values {
+			fields[key] = values.Get(key)
+		}
+		content, _ = json.Marshal(fields)
+	}
+
+	return decodeJSON(bytes.NewReader(content), v)
+}
+
+// QqError QQ互联oauth2.0接口错误结构，error可能为数字（100019）或字符串（invalid_request）
+type QqError struct {
+	Error            json.RawMessage `json:"error"`
+	ErrorDescription string          `json:"error_description"`
+}
+
+func (e *QqError) err() error {
+	var code string
+	if err := json.Unmarshal(e.Error, &code); err != nil {
+		// 非字符串时为数字原文
+		code = string(e.Error)
+	}
+	if len(code) == 0 || code == "0" {
+		return nil
+	}
+
+	return newProviderError(0, code, e.ErrorDescription)
+}
+
+type QqTokenResponse struct {
+	QqError
+	AccessToken  string      `json:"access_token"`
+	ExpiresIn    json.Number `json:"expires_in"`
+	RefreshToken string      `json:"refresh_token"`
+}
+
+// ExchangeContext 使用code换取token
+func (q *QqServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	parsedURL, err := url.Parse(QqTokenPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("grant_type", "authorization_code")
+	queryParams.Add("client_id", q.conf.QqId)
+	queryParams.Add("client_secret", q.conf.QqSecret)
+	queryParams.Add("code", code)
+	queryParams.Add("redirect_uri", q.conf.QqRedirectUrl)
+	queryParams.Add("fmt", "json")
+	parsedURL.RawQuery = queryParams.Encode()
+
+	// code换取token使用GET请求，需标记为不可重复提交
+	response, err := getBase(withNonIdempotent(ctx), q.httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &QqTokenResponse{}
+	raw, err := qqDecode(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	expiresIn, _ := responseStruct.ExpiresIn.Int64()
+
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		Expiry:       expiryIn(expiresIn),
+		Raw:          raw,
+	}, nil
+}
+
+type QqOpenIdResponse struct {
+	QqError
+	ClientId string `json:"client_id"`
+	OpenId   string `json:"openid"`
+	UnionId  string `json:"unionid"`
+}
+
+func (q *QqServer) openId(ctx context.Context, token string) (*QqOpenIdResponse, error) {
+	parsedURL, err := url.Parse(QqOpenIdPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("access_token", token)
+	queryParams.Add("unionid", "1")
+	queryParams.Add("fmt", "json")
+	parsedURL.RawQuery = queryParams.Encode()
+
+	response, err := getBase(ctx, q.httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &QqOpenIdResponse{}
+	if _, err := qqDecode(response, responseStruct); err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	return responseStruct, nil
+}
+
+type QqUserInfo struct {
+	Ret          int    `json:"ret"`
+	Msg          string `json:"msg"`
+	Nickname     string `json:"nickname"`
+	Gender       string `json:"gender"`
+	FigureUrl    string `json:"figureurl"`
+	FigureUrl1   string `json:"figureurl_1"`
+	FigureUrl2   string `json:"figureurl_2"`
+	FigureUrlQq1 string `json:"figureurl_qq_1"`
+	FigureUrlQq2 string `json:"figureurl_qq_2"`
+}
+
+func (q *QqServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := q.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return q.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (q *QqServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	openId, err := q.openId(ctx, token.AccessToken)
+	if err != nil {
+		return nil, fmt.Errorf("openid获取失败:%w", err)
+	}
+
+	parsedURL, err := url.Parse(QqUserInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("access_token", token.AccessToken)
+	queryParams.Add("oauth_consumer_key", q.conf.QqId)
+	queryParams.Add("openid", openId.OpenId)
+	parsedURL.RawQuery = queryParams.Encode()
+
+	response, err := getBase(ctx, q.httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &QqUserInfo{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if responseStruct.Ret != 0 {
+		return nil, newProviderError(response.StatusCode, strconv.Itoa(responseStruct.Ret), responseStruct.Msg)
+	}
+
+	// 优先使用100x100的QQ头像，没有时依次回退到40x40的QQ头像、空间头像
+	avatar := responseStruct.FigureUrlQq2
+	if len(avatar) == 0 {
+		avatar = responseStruct.FigureUrlQq1
+	}
+	if len(avatar) == 0 {
+		avatar = responseStruct.FigureUrl2
+	}
+
+	return &Userinfo{
+		Openid:   openId.OpenId,
+		UnionId:  openId.UnionId,
+		NickName: responseStruct.Nickname,
+		Avatar:   avatar,
+		Raw:      raw,
+	}, nil
+}
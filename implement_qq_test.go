@@ -0,0 +1,79 @@
+package pkg_login
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestQqDecode(t *testing.T) {
+	tests := []struct {
+		name        string
+		status      int
+		body        string
+		wantToken   string
+		wantExpires int64
+		wantCode    string // 期望的服务商错误码
+		wantKind    error  // 期望解析失败的错误分类
+	}{
+		{name: "fmt=json", body: `{"access_token":"AT","expires_in":"7776000","refresh_token":"RT"}`, wantToken: "AT", wantExpires: 7776000},
+		{name: "json数字有效期", body: `{"access_token":"AT","expires_in":7776000,"refresh_token":"RT"}`, wantToken: "AT", wantExpires: 7776000},
+		{name: "表单格式", body: "access_token=AT&expires_in=7776000&refresh_token=RT", wantToken: "AT", wantExpires: 7776000},
+		{name: "jsonp", body: ` callback( {"access_token":"AT","expires_in":"7776000"} ); `, wantToken: "AT", wantExpires: 7776000},
+		{name: "jsonp数字错误码", body: `callback( {"error":100019,"error_description":"code to access token error"} );`, wantCode: "100019"},
+		{name: "json字符串错误码", body: `{"error":"invalid_request","error_description":"invalid code"}`, wantCode: "invalid_request"},
+		{name: "表单错误码", body: "error=invalid_request&error_description=invalid+code", wantCode: "invalid_request"},
+		{name: "错误码为0", body: `{"error":0,"access_token":"AT"}`, wantToken: "AT"},
+		{name: "jsonp格式错误", body: "callback( {", wantKind: ErrInvalidResponse},
+		{name: "非json文本", body: "service unavailable", wantKind: ErrInvalidResponse},
+		{name: "http错误", status: http.StatusBadGateway, body: "bad gateway", wantKind: ErrProviderUnavailable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := tt.status
+			if status == 0 {
+				status = http.StatusOK
+			}
+			response := &http.Response{StatusCode: status, Body: io.NopCloser(strings.NewReader(tt.body))}
+
+			responseStruct := &QqTokenResponse{}
+			_, err := qqDecode(response, responseStruct)
+			if tt.wantKind != nil {
+				var providerErr *ProviderError
+				if !errors.As(err, &providerErr) {
+					t.Fatalf("期望%v，实际: %v", tt.wantKind, err)
+				}
+				// 格式错误解析时已分类，http错误由【Server】按状态码分类
+				kind := providerErr.Kind
+				if kind == nil {
+					kind = classifyProviderError(ProviderQq, StageExchange, providerErr)
+				}
+				if kind != tt.wantKind {
+					t.Fatalf("期望%v，实际: %v", tt.wantKind, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("解析失败: %v", err)
+			}
+
+			var providerErr *ProviderError
+			if err := responseStruct.err(); len(tt.wantCode) > 0 {
+				if !errors.As(err, &providerErr) || providerErr.Code != tt.wantCode {
+					t.Fatalf("期望错误码%s，实际: %v", tt.wantCode, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("期望无错误，实际: %v", err)
+			}
+
+			expiresIn, _ := responseStruct.ExpiresIn.Int64()
+			if responseStruct.AccessToken != tt.wantToken || expiresIn != tt.wantExpires {
+				t.Fatalf("解析结果错误: %+v", responseStruct)
+			}
+		})
+	}
+}
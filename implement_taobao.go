@@ -0,0 +1,152 @@
+package pkg_login
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+/**
+ * Doc : https://open.taobao.com/doc.htm?docId=102635&docType=1
+ */
+
+const (
+	TaobaoRedirectPath = "https://oauth.taobao.com/authorize" // 淘宝获取code地址
+	TaobaoTokenPath    = "https://oauth.taobao.com/token"     // 淘宝获取token地址，token响应中已包含用户信息
+)
+
+func NewTaobaoConf(id, secret, redirectUrl string) *Config {
+	return &Config{
+		TaobaoId:          id,
+		TaobaoSecret:      secret,
+		TaobaoRedirectUrl: redirectUrl,
+	}
+}
+
+type TaobaoServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementTaobao, ProviderTaobao, newTaobaoProvider)
+}
+
+func newTaobaoProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.TaobaoId) == 0 || len(p.Config.TaobaoSecret) == 0 || len(p.Config.TaobaoRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newTaobaoServer(p.Config, p.HttpClient), nil
+}
+
+func newTaobaoServer(conf *Config, httpClient *http.Client) *TaobaoServer {
+	return &TaobaoServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE 淘宝授权不支持PKCE
+func (t *TaobaoServer) SupportPKCE() bool {
+	return false
+}
+
+func (t *TaobaoServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(TaobaoRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("response_type", "code")
+	queryParams.Add("client_id", t.conf.TaobaoId)
+	queryParams.Add("redirect_uri", t.conf.TaobaoRedirectUrl)
+	queryParams.Add("state", state.State)
+	queryParams.Add("view", "web")
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+type TaobaoTokenResponse struct {
+	AccessToken      string      `json:"access_token"`
+	TokenType        string      `json:"token_type"`
+	ExpiresIn        int         `json:"expires_in"`
+	RefreshToken     string      `json:"refresh_token"`
+	ReExpiresIn      int         `json:"re_expires_in"`
+	TaobaoUserId     json.Number `json:"taobao_user_id"`
+	TaobaoUserNick   string      `json:"taobao_user_nick"` // urlencode编码
+	TaobaoOpenUid    string      `json:"taobao_open_uid"`
+	Error            string      `json:"error"`
+	ErrorDescription string      `json:"error_description"`
+}
+
+// ExchangeContext 使用code换取token，淘宝用户信息保存在Raw中
+func (t *TaobaoServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("code", code)
+	formData.Set("client_id", t.conf.TaobaoId)
+	formData.Set("client_secret", t.conf.TaobaoSecret)
+	formData.Set("redirect_uri", t.conf.TaobaoRedirectUrl)
+	formData.Set("grant_type", "authorization_code")
+	formData.Set("view", "web")
+
+	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
+	response, err := postBase(ctx, t.httpClient, TaobaoTokenPath, formData.Encode(), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &TaobaoTokenResponse{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(responseStruct.Error) != 0 {
+		return nil, newProviderError(response.StatusCode, responseStruct.Error, responseStruct.ErrorDescription)
+	}
+
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		TokenType:    responseStruct.TokenType,
+		Expiry:       expiryIn(int64(responseStruct.ExpiresIn)),
+		Raw:          raw,
+	}, nil
+}
+
+func (t *TaobaoServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := t.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return t.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 淘宝没有用户信息接口，直接使用token响应中的用户信息
+func (t *TaobaoServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	userNick, userId, openUid := token.rawString("taobao_user_nick"), token.rawString("taobao_user_id"), token.rawString("taobao_open_uid")
+	nickName, err := url.QueryUnescape(userNick)
+	if err != nil {
+		nickName = userNick
+	}
+
+	// taobao_user_id已不推荐使用，优先使用taobao_open_uid
+	openid := openUid
+	if len(openid) == 0 {
+		openid = userId
+	}
+
+	return &Userinfo{
+		Openid:   openid,
+		UnionId:  userId,
+		NickName: nickName,
+		Raw:      token.userinfoRaw(),
+	}, nil
+}
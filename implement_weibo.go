@@ -0,0 +1,237 @@
+package pkg_login
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/**
+ * Doc : https://open.weibo.com/wiki/%E6%8E%88%E6%9D%83%E6%9C%BA%E5%88%B6%E8%AF%B4%E6%98%8E
+ */
+
+const (
+	WeiBoRedirectPath = "https://api.weibo.com/oauth2/authorize"    // 微博获取code地址
+	WeiBoTokenPath    = "https://api.weibo.com/oauth2/access_token" // 微博获取token地址
+	WeiBoUserInfoPath = "https://api.weibo.com/2/users/show.json"   // 微博获取用户信息接口
+	WeiBoRevokePath   = "https://api.weibo.com/oauth2/revokeoauth2" // 微博撤销授权接口
+	WeiBoProfilePath  = "https://weibo.com/"                        // 微博个人主页地址前缀
+)
+
+func NewWeiBoConf(id, secret, redirectUrl string) *Config {
+	return &Config{
+		WeiBoId:          id,
+		WeiBoSecret:      secret,
+		WeiBoRedirectUrl: redirectUrl,
+	}
+}
+
+type WeiBoServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementWeiBo, ProviderWeiBo, newWeiBoProvider)
+}
+
+func newWeiBoProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.WeiBoId) == 0 || len(p.Config.WeiBoSecret) == 0 || len(p.Config.WeiBoRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newWeiBoServer(p.Config, p.HttpClient), nil
+}
+
+func newWeiBoServer(conf *Config, httpClient *http.Client) *WeiBoServer {
+	return &WeiBoServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE 微博授权不支持PKCE
+func (w *WeiBoServer) SupportPKCE() bool {
+	return false
+}
+
+func (w *WeiBoServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(WeiBoRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("client_id", w.conf.WeiBoId)
+	queryParams.Add("redirect_uri", w.conf.WeiBoRedirectUrl)
+	queryParams.Add("response_type", "code")
+	queryParams.Add("state", state.State)
+
+	parsedURL.RawQuery = queryParams.Encode()
+
+	return parsedURL.String(), nil
+}
+
+// WeiBoError 微博接口通用错误结构
+type WeiBoError struct {
+	Error     string `json:"error"`
+	ErrorCode int    `json:"error_code"`
+	Request   string `json:"request"`
+}
+
+func (e *WeiBoError) err() error {
+	if e.ErrorCode == 0 && len(e.Error) == 0 {
+		return nil
+	}
+
+	return newProviderError(0, strconv.Itoa(e.ErrorCode), e.Error)
+}
+
+type WeiBoTokenResponse struct {
+	WeiBoError
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int    `json:"expires_in"`
+	Uid         string `json:"uid"`
+	IsRealName  string `json:"isRealName"`
+}
+
+// ExchangeContext 使用code换取token，uid保存在Raw中
+func (w *WeiBoServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	formData := url.Values{}
+	formData.Set("code", code)
+	formData.Set("client_id", w.conf.WeiBoId)
+	formData.Set("client_secret", w.conf.WeiBoSecret)
+	formData.Set("redirect_uri", w.conf.WeiBoRedirectUrl)
+	formData.Set("grant_type", "authorization_code")
+
+	headers := map[string]string{"Accept": "application/json", "Content-Type": "application/x-www-form-urlencoded"}
+	response, err := postBase(ctx, w.httpClient, WeiBoTokenPath, formData.Encode(), headers)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &WeiBoTokenResponse{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: responseStruct.AccessToken,
+		Expiry:      expiryIn(int64(responseStruct.ExpiresIn)),
+		Raw:         raw,
+	}, nil
+}
+
+type WeiBoRevokeResponse struct {
+	WeiBoError
+	Result string `json:"result"`
+}
+
+// RevokeContext 撤销授权
+func (w *WeiBoServer) RevokeContext(ctx context.Context, token string) error {
+	formData := url.Values{}
+	formData.Set("access_token", token)
+
+	headers := map[string]string{"Content-Type": "application/x-www-form-urlencoded"}
+	response, err := postBase(ctx, w.httpClient, WeiBoRevokePath, formData.Encode(), headers)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &WeiBoRevokeResponse{}
+	if _, err := decodeResponse(response, responseStruct); err != nil {
+		return err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return err
+	}
+	if responseStruct.Result != "true" {
+		return newProviderError(response.StatusCode, "", "撤销授权失败")
+	}
+
+	return nil
+}
+
+type WeiBoUserInfo struct {
+	WeiBoError
+	Id              int64  `json:"id"`
+	IdStr           string `json:"idstr"`
+	ScreenName      string `json:"screen_name"`
+	Name            string `json:"name"`
+	ProfileImageUrl string `json:"profile_image_url"`
+	AvatarLarge     string `json:"avatar_large"`
+	AvatarHd        string `json:"avatar_hd"`
+	ProfileUrl      string `json:"profile_url"` // 相对地址，如 u/1234567890
+	Lang            string `json:"lang"`
+}
+
+func (w *WeiBoServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := w.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return w.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (w *WeiBoServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	uid := token.rawString("uid")
+
+	parsedURL, err := url.Parse(WeiBoUserInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("access_token", token.AccessToken)
+	queryParams.Add("uid", uid)
+	parsedURL.RawQuery = queryParams.Encode()
+
+	response, err := getBase(ctx, w.httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &WeiBoUserInfo{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	openid := responseStruct.IdStr
+	if len(openid) == 0 {
+		openid = uid
+	}
+
+	var profileUrl string
+	if len(responseStruct.ProfileUrl) > 0 {
+		profileUrl = WeiBoProfilePath + responseStruct.ProfileUrl
+	}
+
+	return &Userinfo{
+		Openid:     openid,
+		NickName:   responseStruct.ScreenName,
+		Avatar:     responseStruct.ProfileImageUrl,
+		ProfileURL: profileUrl,
+		Locale:     responseStruct.Lang,
+		Raw:        raw,
+	}, nil
+}
@@ -0,0 +1,222 @@
+package pkg_login
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+/**
+ * Doc : https://developers.weixin.qq.com/doc/oplatform/Website_App/WeChat_Login/Wechat_Login.html
+ */
+
+const (
+	WeiXinRedirectPath = "https://open.weixin.qq.com/connect/qrconnect"      // 微信获取code地址
+	WeiXinTokenPath    = "https://api.weixin.qq.com/sns/oauth2/access_token" // 微信获取token地址
+	WeiXinUserInfoPath = "https://api.weixin.qq.com/sns/userinfo"            // 微信获取用户信息接口
+)
+
+func NewWeiXinConf(id, secret, redirectUrl string) *Config {
+	return &Config{
+		WeiXinId:          id,
+		WeiXinSecret:      secret,
+		WeiXinRedirectUrl: redirectUrl,
+	}
+}
+
+type WeiXinServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementWeiXin, ProviderWeiXin, newWeiXinProvider)
+}
+
+func newWeiXinProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.WeiXinId) == 0 || len(p.Config.WeiXinSecret) == 0 || len(p.Config.WeiXinRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+
+	return newWeiXinServer(p.Config, p.HttpClient), nil
+}
+
+func newWeiXinServer(conf *Config, httpClient *http.Client) *WeiXinServer {
+	return &WeiXinServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE 微信授权不支持PKCE
+func (w *WeiXinServer) SupportPKCE() bool {
+	return false
+}
+
+func (w *WeiXinServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	parsedURL, err := url.Parse(WeiXinRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("appid", w.conf.WeiXinId)
+	queryParams.Add("redirect_uri", w.conf.WeiXinRedirectUrl)
+	queryParams.Add("response_type", "code")
+	queryParams.Add("scope", "snsapi_login")
+	queryParams.Add("state", state.State)
+
+	parsedURL.RawQuery = queryParams.Encode()
+	parsedURL.Fragment = "wechat_redirect"
+
+	return parsedURL.String(), nil
+}
+
+// ParseCallback 用户拒绝授权时微信只回调state，不携带code及error
+func (w *WeiXinServer) ParseCallback(values url.Values) (*Callback, error) {
+	return weiXinCallback(values)
+}
+
+// weiXinCallback 微信开放平台与公众号共用的回调解析
+func weiXinCallback(values url.Values) (*Callback, error) {
+	if len(values.Get("code")) == 0 && len(values.Get("error")) == 0 {
+		return nil, &ProviderError{Description: "用户拒绝授权", Kind: ErrAccessDenied}
+	}
+
+	return ParseCallbackValues(values)
+}
+
+// WeiXinError 微信接口通用错误结构
+type WeiXinError struct {
+	ErrCode int    `json:"errcode"`
+	ErrMsg  string `json:"errmsg"`
+}
+
+func (e *WeiXinError) err() error {
+	if e.ErrCode == 0 {
+		return nil
+	}
+
+	return newProviderError(0, strconv.Itoa(e.ErrCode), e.ErrMsg)
+}
+
+type WeiXinTokenResponse struct {
+	WeiXinError
+	AccessToken  string `json:"access_token"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Openid       string `json:"openid"`
+	Scope        string `json:"scope"`
+	UnionId      string `json:"unionid"`
+}
+
+// weiXinToken 微信开放平台与公众号共用的code换取token接口，openid、unionid保存在Raw中
+func weiXinToken(ctx context.Context, httpClient *http.Client, appId, secret, code string) (*Token, error) {
+	parsedURL, err := url.Parse(WeiXinTokenPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("appid", appId)
+	queryParams.Add("secret", secret)
+	queryParams.Add("code", code)
+	queryParams.Add("grant_type", "authorization_code")
+	parsedURL.RawQuery = queryParams.Encode()
+
+	// code换取token使用GET请求，需标记为不可重复提交
+	response, err := getBase(withNonIdempotent(ctx), httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &WeiXinTokenResponse{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken:  responseStruct.AccessToken,
+		RefreshToken: responseStruct.RefreshToken,
+		Expiry:       expiryIn(int64(responseStruct.ExpiresIn)),
+		Scopes:       splitScopes(responseStruct.Scope),
+		Raw:          raw,
+	}, nil
+}
+
+type WeiXinUserInfo struct {
+	WeiXinError
+	Openid     string   `json:"openid"`
+	Nickname   string   `json:"nickname"`
+	Sex        int      `json:"sex"`
+	Province   string   `json:"province"`
+	City       string   `json:"city"`
+	Country    string   `json:"country"`
+	HeadImgUrl string   `json:"headimgurl"`
+	Privilege  []string `json:"privilege"`
+	UnionId    string   `json:"unionid"`
+}
+
+// weiXinUserinfo 微信开放平台与公众号共用的用户信息接口
+func weiXinUserinfo(ctx context.Context, httpClient *http.Client, token, openid string) (*Userinfo, error) {
+	parsedURL, err := url.Parse(WeiXinUserInfoPath)
+	if err != nil {
+		return nil, err
+	}
+	queryParams := url.Values{}
+	queryParams.Add("access_token", token)
+	queryParams.Add("openid", openid)
+	queryParams.Add("lang", "zh_CN")
+	parsedURL.RawQuery = queryParams.Encode()
+
+	response, err := getBase(ctx, httpClient, parsedURL.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &WeiXinUserInfo{}
+	raw, err := decodeResponse(response, responseStruct)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := responseStruct.err(); err != nil {
+		return nil, err
+	}
+
+	return &Userinfo{
+		Openid:   responseStruct.Openid,
+		UnionId:  responseStruct.UnionId,
+		NickName: responseStruct.Nickname,
+		Avatar:   responseStruct.HeadImgUrl,
+		Raw:      raw,
+	}, nil
+}
+
+func (w *WeiXinServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := w.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return w.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// ExchangeContext 使用code换取token
+func (w *WeiXinServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	return weiXinToken(ctx, w.httpClient, w.conf.WeiXinId, w.conf.WeiXinSecret, code)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (w *WeiXinServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	return weiXinUserinfo(ctx, w.httpClient, token.AccessToken, token.rawString("openid"))
+}
@@ -0,0 +1,146 @@
+package pkg_login
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+)
+
+/**
+ * Doc : https://developers.weixin.qq.com/doc/offiaccount/OA_Web_Apps/Wechat_webpage_authorization.html
+ */
+
+const (
+	WeiXinMpRedirectPath = "https://open.weixin.qq.com/connect/oauth2/authorize" // 微信公众号获取code地址，token及用户信息接口与微信开放平台一致
+)
+
+const (
+	WeiXinMpScopeBase     = "snsapi_base"     // 静默授权，只能获取openid
+	WeiXinMpScopeUserinfo = "snsapi_userinfo" // 弹出授权页，可获取昵称、头像
+)
+
+// WithWeiXinMpScope 指定本次授权的scope，覆盖配置中的WeiXinMpScope，用于先静默授权获取openid、需要昵称头像时再弹出授权页
+func WithWeiXinMpScope(scope string) RedirectOption {
+	return func(state *AuthState) {
+		state.Scope = scope
+	}
+}
+
+// NewWeiXinMpConf scope为空时默认【WeiXinMpScopeUserinfo】
+func NewWeiXinMpConf(id, secret, redirectUrl, scope string) *Config {
+	return &Config{
+		WeiXinMpId:          id,
+		WeiXinMpSecret:      secret,
+		WeiXinMpRedirectUrl: redirectUrl,
+		WeiXinMpScope:       scope,
+	}
+}
+
+// WeiXinMpServer 微信公众号网页授权，用于微信内置浏览器中打开的H5页面
+type WeiXinMpServer struct {
+	conf       *Config
+	httpClient *http.Client
+}
+
+func init() {
+	registerProvider(ImplementWeiXinMp, ProviderWeiXinMp, newWeiXinMpProvider)
+}
+
+func newWeiXinMpProvider(p ProviderConfig) (Ability, error) {
+	if len(p.Config.WeiXinMpId) == 0 || len(p.Config.WeiXinMpSecret) == 0 || len(p.Config.WeiXinMpRedirectUrl) == 0 {
+		return nil, ErrNotConfigured
+	}
+	if err := checkWeiXinMpScope(p.Config.WeiXinMpScope); err != nil {
+		return nil, err
+	}
+
+	return newWeiXinMpServer(p.Config, p.HttpClient), nil
+}
+
+func newWeiXinMpServer(conf *Config, httpClient *http.Client) *WeiXinMpServer {
+	return &WeiXinMpServer{conf: conf, httpClient: httpClient}
+}
+
+// SupportPKCE 微信授权不支持PKCE
+func (w *WeiXinMpServer) SupportPKCE() bool {
+	return false
+}
+
+// ParseCallback 用户拒绝授权时只回调state，格式同【WeiXinServer.ParseCallback】
+func (w *WeiXinMpServer) ParseCallback(values url.Values) (*Callback, error) {
+	return weiXinCallback(values)
+}
+
+func checkWeiXinMpScope(scope string) error {
+	switch scope {
+	case "", WeiXinMpScopeBase, WeiXinMpScopeUserinfo:
+		return nil
+	}
+
+	return fmt.Errorf("%w:微信公众号scope仅支持snsapi_base、snsapi_userinfo", ErrNotConfigured)
+}
+
+// scope 优先使用本次授权指定的scope
+func (w *WeiXinMpServer) scope(state *AuthState) string {
+	switch {
+	case len(state.Scope) > 0:
+		return state.Scope
+	case len(w.conf.WeiXinMpScope) > 0:
+		return w.conf.WeiXinMpScope
+	}
+
+	return WeiXinMpScopeUserinfo
+}
+
+func (w *WeiXinMpServer) RedirectUrlContext(ctx context.Context, state *AuthState) (string, error) {
+	if err := checkWeiXinMpScope(state.Scope); err != nil {
+		return "", err
+	}
+
+	parsedURL, err := url.Parse(WeiXinMpRedirectPath)
+	if err != nil {
+		return "", err
+	}
+
+	queryParams := url.Values{}
+	queryParams.Add("appid", w.conf.WeiXinMpId)
+	queryParams.Add("redirect_uri", w.conf.WeiXinMpRedirectUrl)
+	queryParams.Add("response_type", "code")
+	queryParams.Add("scope", w.scope(state))
+	queryParams.Add("state", state.State)
+
+	parsedURL.RawQuery = queryParams.Encode()
+	parsedURL.Fragment = "wechat_redirect"
+
+	return parsedURL.String(), nil
+}
+
+func (w *WeiXinMpServer) GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error) {
+	token, err := w.ExchangeContext(ctx, code, state)
+	if err != nil {
+		return nil, fmt.Errorf("token获取失败:%w", err)
+	}
+
+	return w.GetUserinfoWithTokenContext(ctx, token)
+}
+
+// ExchangeContext 使用code换取token
+func (w *WeiXinMpServer) ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error) {
+	return weiXinToken(ctx, w.httpClient, w.conf.WeiXinMpId, w.conf.WeiXinMpSecret, code)
+}
+
+// GetUserinfoWithTokenContext 使用token获取账户信息
+func (w *WeiXinMpServer) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	// 静默授权只返回openid（及已绑定开放平台时的unionid），无法调用用户信息接口
+	if !slices.Contains(token.Scopes, WeiXinMpScopeUserinfo) {
+		return &Userinfo{
+			Openid:  token.rawString("openid"),
+			UnionId: token.rawString("unionid"),
+			Raw:     token.userinfoRaw(),
+		}, nil
+	}
+
+	return weiXinUserinfo(ctx, w.httpClient, token.AccessToken, token.rawString("openid"))
+}
@@ -0,0 +1,277 @@
+package pkg_login
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	idTokenLeeway       = time.Minute // 校验exp、iat时允许的时钟误差
+	jwksDefaultMaxAge   = time.Hour   // 响应未返回Cache-Control时的JWKS缓存时间
+	jwksRefreshInterval = time.Minute // kid未命中时强制刷新JWKS的最小间隔
+)
+
+// IDTokenClaims OpenID Connect ID Token声明
+type IDTokenClaims struct {
+	Issuer        string         `json:"iss"`
+	Subject       string         `json:"sub"`
+	Audience      []string       `json:"aud"`
+	ExpiresAt     int64          `json:"exp"`
+	IssuedAt      int64          `json:"iat"`
+	Nonce         string         `json:"nonce"`
+	Email         string         `json:"email"`
+	EmailVerified bool           `json:"email_verified"`
+	Name          string         `json:"name"`
+	Picture       string         `json:"picture"`
+	HostedDomain  string         `json:"hd"` // 谷歌Workspace账号所属域名
+	Raw           map[string]any `json:"raw"`
+}
+
+// idTokenVerify ID Token校验参数
+type idTokenVerify struct {
+	JwksUrl  string   // 签名公钥地址
+	Issuers  []string // 允许的iss
+	ClientId string   // aud必须包含的client_id
+	Nonce    string   // 为空时不校验nonce
+}
+
+// verifyIDToken 校验RS256签名的ID Token并返回声明
+func verifyIDToken(ctx context.Context, httpClient *http.Client, idToken string, verify idTokenVerify) (*IDTokenClaims, error) {
+	parts := strings.Split(idToken, ".")
+	if len(parts) != 3 {
+		return nil, idTokenError("id_token格式错误")
+	}
+
+	headerBytes, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, idTokenError("id_token header解析失败:" + err.Error())
+	}
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := json.Unmarshal(headerBytes, &header); err != nil {
+		return nil, idTokenError("id_token header解析失败:" + err.Error())
+	}
+	if header.Alg != "RS256" {
+		return nil, idTokenError("id_token签名算法不支持:" + header.Alg)
+	}
+
+	publicKey, err := jwksFor(verify.JwksUrl).key(ctx, httpClient, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, idTokenError("id_token签名解析失败:" + err.Error())
+	}
+	hashed := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hashed[:], signature); err != nil {
+		return nil, idTokenError("id_token验签失败:" + err.Error())
+	}
+
+	payloadBytes, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, idTokenError("id_token payload解析失败:" + err.Error())
+	}
+	claims, err := parseIDTokenClaims(payloadBytes)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if !slices.Contains(verify.Issuers, claims.Issuer) {
+		return nil, idTokenError("id_token iss不匹配:" + claims.Issuer)
+	}
+	if !slices.Contains(claims.Audience, verify.ClientId) {
+		return nil, idTokenError("id_token aud不匹配")
+	}
+	if azp, _ := claims.Raw["azp"].(string); len(claims.Audience) > 1 && azp != verify.ClientId {
+		return nil, idTokenError("id_token azp不匹配")
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(idTokenLeeway)) {
+		return nil, idTokenError("id_token已过期")
+	}
+	if claims.IssuedAt != 0 && time.Unix(claims.IssuedAt, 0).After(now.Add(idTokenLeeway)) {
+		return nil, idTokenError("id_token签发时间无效")
+	}
+	if len(verify.Nonce) > 0 && claims.Nonce != verify.Nonce {
+		return nil, idTokenError("id_token nonce不匹配")
+	}
+
+	return claims, nil
+}
+
+// idTokenError id_token格式、签名或声明校验失败
+func idTokenError(description string) *ProviderError {
+	return &ProviderError{Description: description, Kind: ErrInvalidIDToken}
+}
+
+// parseIDTokenClaims aud可能为字符串或数组，email_verified部分服务商返回字符串
+func parseIDTokenClaims(payload []byte) (*IDTokenClaims, error) {
+	raw := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(payload))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, idTokenError("id_token payload解析失败:" + err.Error())
+	}
+
+	claims := &IDTokenClaims{Raw: raw}
+	claims.Issuer, _ = raw["iss"].(string)
+	claims.Subject, _ = raw["sub"].(string)
+	claims.Nonce, _ = raw["nonce"].(string)
+	claims.Email, _ = raw["email"].(string)
+	claims.Name, _ = raw["name"].(string)
+	claims.Picture, _ = raw["picture"].(string)
+	claims.HostedDomain, _ = raw["hd"].(string)
+
+	switch aud := raw["aud"].(type) {
+	case string:
+		claims.Audience = []string{aud}
+	case []any:
+		for _, val := range aud {
+			if str, ok := val.(string); ok {
+				claims.Audience = append(claims.Audience, str)
+			}
+		}
+	}
+
+	switch verified := raw["email_verified"].(type) {
+	case bool:
+		claims.EmailVerified = verified
+	case string:
+		claims.EmailVerified, _ = strconv.ParseBool(verified)
+	}
+
+	if exp, ok := raw["exp"].(json.Number); ok {
+		claims.ExpiresAt, _ = exp.Int64()
+	}
+	if iat, ok := raw["iat"].(json.Number); ok {
+		claims.IssuedAt, _ = iat.Int64()
+	}
+
+	return claims, nil
+}
+
+// jwksCache 按地址缓存的签名公钥
+type jwksCache struct {
+	url       string
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	expireAt  time.Time
+	fetchedAt time.Time
+}
+
+var jwksCaches sync.Map // jwks地址 => *jwksCache
+
+func jwksFor(url string) *jwksCache {
+	cache, _ := jwksCaches.LoadOrStore(url, &jwksCache{url: url})
+	return cache.(*jwksCache)
+}
+
+// key 获取kid对应的公钥，缓存过期或kid未命中（服务商轮换密钥）时重新拉取
+func (c *jwksCache) key(ctx context.Context, httpClient *http.Client, kid string) (*rsa.PublicKey, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	if publicKey, ok := c.keys[kid]; ok && now.Before(c.expireAt) {
+		return publicKey, nil
+	}
+	if c.keys != nil && now.Before(c.expireAt) && now.Sub(c.fetchedAt) < jwksRefreshInterval {
+		return nil, idTokenError("id_token kid不存在:" + kid)
+	}
+
+	if err := c.fetch(ctx, httpClient); err != nil {
+		return nil, fmt.Errorf("jwks获取失败:%w", err)
+	}
+	if publicKey, ok := c.keys[kid]; ok {
+		return publicKey, nil
+	}
+
+	return nil, idTokenError("id_token kid不存在:" + kid)
+}
+
+type jwksResponse struct {
+	Keys []struct {
+		Kty string `json:"kty"`
+		Kid string `json:"kid"`
+		Use string `json:"use"`
+		N   string `json:"n"`
+		E   string `json:"e"`
+	} `json:"keys"`
+}
+
+// fetch 拉取JWKS，调用方需持有锁
+func (c *jwksCache) fetch(ctx context.Context, httpClient *http.Client) error {
+	response, err := getBase(ctx, httpClient, c.url, map[string]string{"Accept": "application/json"})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = response.Body.Close()
+	}()
+
+	responseStruct := &jwksResponse{}
+	if _, err := decodeResponse(response, responseStruct); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(responseStruct.Keys))
+	for _, item := range responseStruct.Keys {
+		if item.Kty != "RSA" || (len(item.Use) > 0 && item.Use != "sig") {
+			continue
+		}
+		n, err := base64.RawURLEncoding.DecodeString(item.N)
+		if err != nil {
+			continue
+		}
+		e, err := base64.RawURLEncoding.DecodeString(item.E)
+		if err != nil {
+			continue
+		}
+		keys[item.Kid] = &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}
+	}
+	if len(keys) == 0 {
+		return invalidResponse("jwks中没有可用的RSA公钥")
+	}
+
+	now := time.Now()
+	c.keys = keys
+	c.fetchedAt = now
+	c.expireAt = now.Add(cacheMaxAge(response.Header.Get("Cache-Control")))
+
+	return nil
+}
+
+// cacheMaxAge 解析Cache-Control中的max-age
+func cacheMaxAge(cacheControl string) time.Duration {
+	for _, directive := range strings.Split(cacheControl, ",") {
+		directive = strings.TrimSpace(directive)
+		if !strings.HasPrefix(directive, "max-age=") {
+			continue
+		}
+		seconds, err := strconv.Atoi(strings.TrimPrefix(directive, "max-age="))
+		if err == nil && seconds > 0 {
+			return time.Duration(seconds) * time.Second
+		}
+	}
+
+	return jwksDefaultMaxAge
+}
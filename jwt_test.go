@@ -0,0 +1,229 @@
+package pkg_login
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+const (
+	testIssuer   = "https://issuer.example.com"
+	testClientId = "client-id"
+)
+
+func newTestRsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("生成RSA密钥失败: %v", err)
+	}
+
+	return key
+}
+
+// testJwksServer 可动态增加公钥的JWKS服务，记录拉取次数
+type testJwksServer struct {
+	*httptest.Server
+	mu   sync.Mutex
+	keys map[string]*rsa.PublicKey
+	hits atomic.Int32
+}
+
+func newTestJwksServer(t *testing.T, keys map[string]*rsa.PublicKey) *testJwksServer {
+	t.Helper()
+
+	s := &testJwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		items := make([]map[string]string, 0, len(s.keys))
+		for kid, key := range s.keys {
+			items = append(items, map[string]string{
+				"kty": "RSA",
+				"use": "sig",
+				"kid": kid,
+				"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(map[string]any{"keys": items})
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testJwksServer) addKey(kid string, key *rsa.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.keys[kid] = key
+}
+
+func signTestIDToken(t *testing.T, key *rsa.PrivateKey, alg, kid string, claims map[string]any) string {
+	t.Helper()
+
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+	hashed := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hashed[:])
+	if err != nil {
+		t.Fatalf("id_token签名失败: %v", err)
+	}
+
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func validTestClaims() map[string]any {
+	now := time.Now()
+	return map[string]any{
+		"iss":   testIssuer,
+		"sub":   "10001",
+		"aud":   testClientId,
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"nonce": "nonce-1",
+		"email": "user@example.com",
+	}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	key := newTestRsaKey(t)
+	otherKey := newTestRsaKey(t)
+	jwks := newTestJwksServer(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+
+	verify := idTokenVerify{JwksUrl: jwks.URL, Issuers: []string{testIssuer}, ClientId: testClientId, Nonce: "nonce-1"}
+	withClaim := func(name string, val any) map[string]any {
+		claims := validTestClaims()
+		if val == nil {
+			delete(claims, name)
+		} else {
+			claims[name] = val
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		idToken string
+		verify  idTokenVerify
+		wantErr string // 期望的错误描述，为空时期望校验通过
+	}{
+		{name: "有效", idToken: signTestIDToken(t, key, "RS256", "k1", validTestClaims()), verify: verify},
+		{name: "不校验nonce", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("nonce", nil)), verify: idTokenVerify{JwksUrl: jwks.URL, Issuers: []string{testIssuer}, ClientId: testClientId}},
+		{name: "aud为数组且azp匹配", idToken: signTestIDToken(t, key, "RS256", "k1", func() map[string]any {
+			claims := withClaim("aud", []string{testClientId, "other"})
+			claims["azp"] = testClientId
+			return claims
+		}()), verify: verify},
+		{name: "签名错误", idToken: signTestIDToken(t, otherKey, "RS256", "k1", validTestClaims()), verify: verify, wantErr: "验签失败"},
+		{name: "签名算法不支持", idToken: signTestIDToken(t, key, "HS256", "k1", validTestClaims()), verify: verify, wantErr: "签名算法不支持"},
+		{name: "格式错误", idToken: "a.b", verify: verify, wantErr: "格式错误"},
+		{name: "iss不匹配", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("iss", "https://evil.example.com")), verify: verify, wantErr: "iss不匹配"},
+		{name: "aud不匹配", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("aud", "other")), verify: verify, wantErr: "aud不匹配"},
+		{name: "aud为数组且azp不匹配", idToken: signTestIDToken(t, key, "RS256", "k1", func() map[string]any {
+			claims := withClaim("aud", []string{testClientId, "other"})
+			claims["azp"] = "other"
+			return claims
+		}()), verify: verify, wantErr: "azp不匹配"},
+		{name: "已过期", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("exp", time.Now().Add(-idTokenLeeway-time.Minute).Unix())), verify: verify, wantErr: "已过期"},
+		{name: "缺失exp", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("exp", nil)), verify: verify, wantErr: "已过期"},
+		{name: "签发时间在未来", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("iat", time.Now().Add(idTokenLeeway+time.Minute).Unix())), verify: verify, wantErr: "签发时间无效"},
+		{name: "nonce不匹配", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("nonce", "nonce-2")), verify: verify, wantErr: "nonce不匹配"},
+		{name: "缺失nonce", idToken: signTestIDToken(t, key, "RS256", "k1", withClaim("nonce", nil)), verify: verify, wantErr: "nonce不匹配"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := verifyIDToken(context.Background(), http.DefaultClient, tt.idToken, tt.verify)
+			if len(tt.wantErr) > 0 {
+				if !errors.Is(err, ErrInvalidIDToken) || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("期望ErrInvalidIDToken(%s)，实际: %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("校验失败: %v", err)
+			}
+			if claims.Subject != "10001" || claims.Email != "user@example.com" {
+				t.Fatalf("声明解析错误: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestVerifyIDTokenUnknownKid(t *testing.T) {
+	key := newTestRsaKey(t)
+	rotatedKey := newTestRsaKey(t)
+	jwks := newTestJwksServer(t, map[string]*rsa.PublicKey{"k1": &key.PublicKey})
+	verify := idTokenVerify{JwksUrl: jwks.URL, Issuers: []string{testIssuer}, ClientId: testClientId}
+
+	if _, err := verifyIDToken(context.Background(), http.DefaultClient, signTestIDToken(t, key, "RS256", "k1", validTestClaims()), verify); err != nil {
+		t.Fatalf("校验失败: %v", err)
+	}
+	if hits := jwks.hits.Load(); hits != 1 {
+		t.Fatalf("期望拉取1次JWKS，实际%d次", hits)
+	}
+
+	// 服务商轮换密钥，刷新间隔内不重复拉取
+	jwks.addKey("k2", &rotatedKey.PublicKey)
+	rotated := signTestIDToken(t, rotatedKey, "RS256", "k2", validTestClaims())
+	if _, err := verifyIDToken(context.Background(), http.DefaultClient, rotated, verify); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("刷新间隔内期望ErrInvalidIDToken，实际: %v", err)
+	}
+	if hits := jwks.hits.Load(); hits != 1 {
+		t.Fatalf("刷新间隔内不应重新拉取JWKS，实际%d次", hits)
+	}
+
+	// 超过刷新间隔后kid未命中时重新拉取
+	cache := jwksFor(jwks.URL)
+	cache.mu.Lock()
+	cache.fetchedAt = cache.fetchedAt.Add(-jwksRefreshInterval)
+	cache.mu.Unlock()
+
+	if _, err := verifyIDToken(context.Background(), http.DefaultClient, rotated, verify); err != nil {
+		t.Fatalf("重新拉取JWKS后校验失败: %v", err)
+	}
+	if hits := jwks.hits.Load(); hits != 2 {
+		t.Fatalf("期望拉取2次JWKS，实际%d次", hits)
+	}
+
+	// 重新拉取后仍不存在的kid
+	unknown := signTestIDToken(t, rotatedKey, "RS256", "k3", validTestClaims())
+	if _, err := verifyIDToken(context.Background(), http.DefaultClient, unknown, verify); !errors.Is(err, ErrInvalidIDToken) {
+		t.Fatalf("期望ErrInvalidIDToken，实际: %v", err)
+	}
+}
+
+func TestCacheMaxAge(t *testing.T) {
+	tests := map[string]time.Duration{
+		"":                                       jwksDefaultMaxAge,
+		"public, max-age=19800, must-revalidate": 19800 * time.Second,
+		"max-age=0":                              jwksDefaultMaxAge,
+		"no-cache":                               jwksDefaultMaxAge,
+	}
+	for cacheControl, want := range tests {
+		if got := cacheMaxAge(cacheControl); got != want {
+			t.Errorf("cacheMaxAge(%q) = %v，期望 %v", cacheControl, got, want)
+		}
+	}
+}
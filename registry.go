@@ -0,0 +1,100 @@
+package pkg_login
+
+import (
+	"net/http"
+	"sort"
+	"sync"
+)
+
+// ProviderConfig 创建服务商实现时的入参
+type ProviderConfig struct {
+	Name        string       // 注册名
+	ImplementId int8         // 内置服务商id，自定义服务商为0
+	Config      *Config      // 所属实例的配置，只读
+	HttpClient  *http.Client // 请求服务商使用的http客户端
+}
+
+// ProviderFactory 服务商实现构造方法，配置缺失时应返回错误
+type ProviderFactory func(ProviderConfig) (Ability, error)
+
+var (
+	providers   = make(map[string]ProviderFactory) // 注册名 => 构造方法
+	providerIds = make(map[int8]string)            // 内置服务商id => 注册名
+	providersMu sync.RWMutex
+)
+
+// RegisterProvider 注册自定义服务商，名称重复或factory为空时panic，通常在init中调用
+func RegisterProvider(name string, factory func(ProviderConfig) (Ability, error)) {
+	registerProvider(0, name, factory)
+}
+
+func registerProvider(implementId int8, name string, factory ProviderFactory) {
+	if len(name) == 0 {
+		panic("pkg_login: 服务商名称不能为空")
+	}
+	if factory == nil {
+		panic("pkg_login: 服务商【" + name + "】factory不能为空")
+	}
+
+	providersMu.Lock()
+	defer providersMu.Unlock()
+
+	if _, ok := providers[name]; ok {
+		panic("pkg_login: 服务商【" + name + "】重复注册")
+	}
+	if implementId != 0 {
+		if _, ok := providerIds[implementId]; ok {
+			panic("pkg_login: 服务商【" + name + "】id重复注册")
+		}
+		providerIds[implementId] = name
+	}
+	providers[name] = factory
+}
+
+// Providers 已注册的服务商名称
+func Providers() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+func lookupProvider(name string) (ProviderFactory, bool) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	factory, ok := providers[name]
+	return factory, ok
+}
+
+func lookupProviderName(implementId int8) (string, error) {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	name, ok := providerIds[implementId]
+	if !ok {
+		return "", ErrUnknownProvider
+	}
+
+	return name, nil
+}
+
+// providerImplementId 注册名对应的内置服务商id，自定义服务商返回0
+func providerImplementId(name string) int8 {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+
+	for id, val := range providerIds {
+		if val == name {
+			return id
+		}
+	}
+
+	return 0
+}
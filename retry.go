@@ -0,0 +1,241 @@
+package pkg_login
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBreakerThreshold   = 5                // 默认连续失败多少次后熔断
+	DefaultBreakerOpenTimeout = time.Second * 30 // 默认熔断持续时间，到期后放行一个探测请求
+)
+
+// RetryPolicy 请求重试策略：GET请求在网络错误、超时、5xx及429时重试；POST等非幂等请求及code换取token、刷新token请求
+// （微信、QQ使用GET）仅在连接建立失败（请求未发出）时重试，避免一次性的code或refresh_token被重复提交
+type RetryPolicy struct {
+	MaxAttempts int           // 最大尝试次数，包括首次请求，小于等于1时不重试
+	BaseDelay   time.Duration // 首次重试的基础等待时间，之后每次翻倍
+	MaxDelay    time.Duration // 单次等待时间上限
+}
+
+// DefaultRetryPolicy 默认重试策略
+var DefaultRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond * 200, MaxDelay: time.Second * 2}
+
+// backoff 第attempt次重试前的等待时间，在[delay/2, delay]之间随机，避免多个请求同时重试
+func (p RetryPolicy) backoff(attempt int) time.Duration {
+	delay := p.BaseDelay << attempt
+	if delay <= 0 || delay > p.MaxDelay {
+		delay = p.MaxDelay
+	}
+	if delay <= 0 {
+		return 0
+	}
+
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+type nonIdempotentKey struct{}
+
+// withNonIdempotent 标记ctx下的请求不可重复提交，不论请求方法
+func withNonIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, nonIdempotentKey{}, true)
+}
+
+// idempotent GET、HEAD且未被【withNonIdempotent】标记的请求可安全重试
+func idempotent(req *http.Request) bool {
+	if marked, _ := req.Context().Value(nonIdempotentKey{}).(bool); marked {
+		return false
+	}
+
+	return req.Method == http.MethodGet || req.Method == http.MethodHead
+}
+
+// circuitBreaker 服务商熔断器，连续失败达到阈值后在openTimeout内直接失败，到期后放行一个探测请求
+type circuitBreaker struct {
+	mu          sync.Mutex
+	threshold   int
+	openTimeout time.Duration
+	failures    int
+	openUntil   time.Time
+	probing     bool
+}
+
+func newCircuitBreaker(threshold int, openTimeout time.Duration) *circuitBreaker {
+	return &circuitBreaker{threshold: threshold, openTimeout: openTimeout}
+}
+
+func (b *circuitBreaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return true
+	}
+	if time.Now().Before(b.openUntil) || b.probing {
+		return false
+	}
+	b.probing = true
+
+	return true
+}
+
+// record 记录请求结果，canceled为true表示调用方主动取消，只释放探测名额不计入结果
+func (b *circuitBreaker) record(success, canceled bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if canceled {
+		return
+	}
+	if success {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.openTimeout)
+	}
+}
+
+// resilientTransport 为请求增加重试及熔断，每次尝试单独计算超时
+type resilientTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration // 单次尝试超时，0为不限制
+	retry   RetryPolicy
+	breaker *circuitBreaker // 为nil时不熔断
+}
+
+// newResilientClient 包装http客户端，原客户端的超时时间作为单次尝试的超时时间
+func newResilientClient(client *http.Client, retry RetryPolicy, breaker *circuitBreaker) *http.Client {
+	if retry.MaxAttempts <= 1 && breaker == nil {
+		return client
+	}
+
+	base := client.Transport
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	return &http.Client{
+		Transport: &resilientTransport{
+			base:    base,
+			timeout: client.Timeout,
+			retry:   retry,
+			breaker: breaker,
+		},
+		CheckRedirect: client.CheckRedirect,
+		Jar:           client.Jar,
+	}
+}
+
+func (t *resilientTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if t.breaker != nil && !t.breaker.allow() {
+		// RoundTripper需关闭请求体，即使请求未发出
+		if req.Body != nil {
+			_ = req.Body.Close()
+		}
+		return nil, &ProviderError{Description: "服务商连续请求失败，已暂停请求", Kind: ErrProviderUnavailable}
+	}
+
+	attempts := max(t.retry.MaxAttempts, 1)
+	for attempt := 0; ; attempt++ {
+		response, err := t.roundTrip(req, attempt)
+		if attempt+1 >= attempts || !t.retryable(req, response, err) {
+			t.record(req, response, err)
+			return response, err
+		}
+
+		if response != nil {
+			_, _ = io.Copy(io.Discard, io.LimitReader(response.Body, maxResponseBodySize))
+			_ = response.Body.Close()
+		}
+
+		timer := time.NewTimer(t.retry.backoff(attempt))
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			t.record(req, nil, req.Context().Err())
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip 单次尝试，重试时重新生成请求体
+func (t *resilientTransport) roundTrip(req *http.Request, attempt int) (*http.Response, error) {
+	ctx, cancel := req.Context(), context.CancelFunc(func() {})
+	if t.timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, t.timeout)
+	}
+
+	attemptReq := req.Clone(ctx)
+	if attempt > 0 && req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		attemptReq.Body = body
+	}
+
+	response, err := t.base.RoundTrip(attemptReq)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// 超时需覆盖读取响应体，关闭响应体时再释放
+	response.Body = &cancelBody{ReadCloser: response.Body, cancel: cancel}
+
+	return response, nil
+}
+
+// retryable 调用方已取消时不重试
+func (t *resilientTransport) retryable(req *http.Request, response *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if req.Body != nil && req.GetBody == nil {
+		return false
+	}
+
+	if idempotent(req) {
+		return err != nil || response.StatusCode >= 500 || response.StatusCode == http.StatusTooManyRequests
+	}
+
+	return err != nil && isDialError(err)
+}
+
+// record 记录最终结果，4xx说明服务商可用
+func (t *resilientTransport) record(req *http.Request, response *http.Response, err error) {
+	if t.breaker == nil {
+		return
+	}
+
+	success := err == nil && response.StatusCode < 500 && response.StatusCode != http.StatusTooManyRequests
+	t.breaker.record(success, errors.Is(req.Context().Err(), context.Canceled))
+}
+
+// isDialError 连接建立阶段的错误（含DNS解析失败），此时请求尚未发出
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
@@ -0,0 +1,108 @@
+package pkg_login
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var testRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond * 5}
+
+// newTestUpstream 返回固定状态码的测试服务并记录请求次数
+func newTestUpstream(t *testing.T, status int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	hits := &atomic.Int32{}
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(upstream.Close)
+
+	return upstream, hits
+}
+
+func TestResilientClientRetry(t *testing.T) {
+	tests := []struct {
+		name     string
+		method   string
+		ctx      context.Context
+		wantHits int32
+	}{
+		{name: "GET重试", method: http.MethodGet, ctx: context.Background(), wantHits: 3},
+		{name: "POST不重试", method: http.MethodPost, ctx: context.Background(), wantHits: 1},
+		{name: "换取token的GET不重试", method: http.MethodGet, ctx: withNonIdempotent(context.Background()), wantHits: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			upstream, hits := newTestUpstream(t, http.StatusBadGateway)
+			client := newResilientClient(&http.Client{}, testRetryPolicy, nil)
+
+			req, _ := http.NewRequestWithContext(tt.ctx, tt.method, upstream.URL, nil)
+			response, err := client.Do(req)
+			if err != nil {
+				t.Fatalf("请求失败: %v", err)
+			}
+			_ = response.Body.Close()
+
+			if got := hits.Load(); got != tt.wantHits {
+				t.Fatalf("期望请求%d次，实际%d次", tt.wantHits, got)
+			}
+		})
+	}
+}
+
+func TestResilientClientRetryDialError(t *testing.T) {
+	upstream := httptest.NewServer(http.NotFoundHandler())
+	target, _ := url.Parse(upstream.URL)
+	upstream.Close()
+
+	attempts := &atomic.Int32{}
+	base := &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		attempts.Add(1)
+		return rewriteTransport{target: target}.RoundTrip(req)
+	})}
+	client := newResilientClient(base, testRetryPolicy, nil)
+
+	// 连接建立失败时请求未发出，换取token的请求也可以重试
+	req, _ := http.NewRequestWithContext(withNonIdempotent(context.Background()), http.MethodGet, "https://example.com/token", nil)
+	if _, err := client.Do(req); classifyCause(err) != ErrProviderUnavailable {
+		t.Fatalf("期望网络错误，实际: %v", err)
+	}
+	if got := attempts.Load(); got != 3 {
+		t.Fatalf("期望尝试3次，实际%d次", got)
+	}
+}
+
+func TestResilientClientCircuitBreaker(t *testing.T) {
+	upstream, hits := newTestUpstream(t, http.StatusServiceUnavailable)
+	client := newResilientClient(&http.Client{}, RetryPolicy{}, newCircuitBreaker(2, time.Hour))
+
+	for i := 0; i < 2; i++ {
+		response, err := client.Get(upstream.URL)
+		if err != nil {
+			t.Fatalf("请求失败: %v", err)
+		}
+		_ = response.Body.Close()
+	}
+
+	_, err := client.Get(upstream.URL)
+	if !errors.Is(err, ErrProviderUnavailable) {
+		t.Fatalf("熔断后期望ErrProviderUnavailable，实际: %v", err)
+	}
+	if got := hits.Load(); got != 2 {
+		t.Fatalf("熔断后不应请求服务商，实际请求%d次", got)
+	}
+}
+
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
@@ -1,110 +1,626 @@
 package pkg_login
 
-import "errors"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+const (
+	ImplementGoogle   int8 = 1  // 谷歌
+	ImplementWeiXin   int8 = 2  // 微信
+	ImplementGithub   int8 = 3  // github
+	ImplementQq       int8 = 4  // qq
+	ImplementWeiBo    int8 = 5  // 微博
+	ImplementDingDing int8 = 6  // 钉钉
+	ImplementGitee    int8 = 7  // gitee码云
+	ImplementFeiShu   int8 = 8  // 飞书
+	ImplementWeiXinMp int8 = 9  // 微信公众号
+	ImplementAlipay   int8 = 10 // 支付宝
+	ImplementTaobao   int8 = 11 // 淘宝
+)
 
+// 内置服务商注册名
 const (
-	ImplementGoogle   int8 = 1 // 谷歌
-	ImplementWeiXin   int8 = 2 // 微信
-	ImplementGithub   int8 = 3 // github
-	ImplementQq       int8 = 4 // qq
-	ImplementWeiBo    int8 = 5 // 微博
-	ImplementDingDing int8 = 6 // 钉钉
-	ImplementGitee    int8 = 7 // gitee码云
-	ImplementFeiShu   int8 = 8 // 飞书
+	ProviderGoogle   = "google"
+	ProviderWeiXin   = "weixin"
+	ProviderWeiXinMp = "weixin_mp"
+	ProviderQq       = "qq"
+	ProviderWeiBo    = "weibo"
+	ProviderAlipay   = "alipay"
+	ProviderTaobao   = "taobao"
+	ProviderGithub   = "github"
+	ProviderDingDing = "dingding"
+	ProviderGitee    = "gitee"
+	ProviderFeiShu   = "feishu"
 )
 
 var (
-	config  Config // 全局配置
-	hasInit bool   // 配置是否初始化
+	defaultClient   *Client      // 【Init】注册的默认实例
+	defaultClientMu sync.RWMutex // 保护defaultClient
 )
 
 type Config struct {
-	GoogleId            string `json:"google_id"`
-	GoogleSecret        string `json:"google_secret"`
-	GoogleRedirectUrl   string `json:"google_redirect_url"`
-	GithubId            string `json:"github_id"`
-	GithubSecret        string `json:"github_secret"`
-	GithubRedirectUrl   string `json:"github_redirect_url"`
-	GiteeId             string `json:"gitee_id"`
-	GiteeSecret         string `json:"gitee_secret"`
-	GiteeRedirectUrl    string `json:"gitee_redirect_url"`
-	DingDingId          string `json:"ding_ding_id"`
-	DingDingSecret      string `json:"ding_ding_secret"`
-	DingDingRedirectUrl string `json:"ding_ding_redirect_url"`
-	FeiShuId            string `json:"fei_shu_id"`
-	FeiShuSecret        string `json:"fei_shu_secret"`
-	FeiShuRedirectUrl   string `json:"fei_shu_redirect_url"`
+	GoogleId                   string `json:"google_id"`
+	GoogleSecret               string `json:"google_secret"`
+	GoogleRedirectUrl          string `json:"google_redirect_url"`
+	GithubId                   string `json:"github_id"`
+	GithubSecret               string `json:"github_secret"`
+	GithubRedirectUrl          string `json:"github_redirect_url"`
+	GithubRequireVerifiedEmail bool   `json:"github_require_verified_email"` // 为true时账号没有已验证的主邮箱则登录失败
+	GiteeId                    string `json:"gitee_id"`
+	GiteeSecret                string `json:"gitee_secret"`
+	GiteeRedirectUrl           string `json:"gitee_redirect_url"`
+	DingDingId                 string `json:"ding_ding_id"`
+	DingDingSecret             string `json:"ding_ding_secret"`
+	DingDingRedirectUrl        string `json:"ding_ding_redirect_url"`
+	FeiShuId                   string `json:"fei_shu_id"`
+	FeiShuSecret               string `json:"fei_shu_secret"`
+	FeiShuRedirectUrl          string `json:"fei_shu_redirect_url"`
+	WeiXinId                   string `json:"wei_xin_id"`
+	WeiXinSecret               string `json:"wei_xin_secret"`
+	WeiXinRedirectUrl          string `json:"wei_xin_redirect_url"`
+	WeiXinMpId                 string `json:"wei_xin_mp_id"`
+	WeiXinMpSecret             string `json:"wei_xin_mp_secret"`
+	WeiXinMpRedirectUrl        string `json:"wei_xin_mp_redirect_url"`
+	WeiXinMpScope              string `json:"wei_xin_mp_scope"` // snsapi_base 或 snsapi_userinfo，默认 snsapi_userinfo
+	QqId                       string `json:"qq_id"`
+	QqSecret                   string `json:"qq_secret"`
+	QqRedirectUrl              string `json:"qq_redirect_url"`
+	WeiBoId                    string `json:"wei_bo_id"`
+	WeiBoSecret                string `json:"wei_bo_secret"`
+	WeiBoRedirectUrl           string `json:"wei_bo_redirect_url"`
+	AlipayId                   string `json:"alipay_id"`
+	AlipayPrivateKey           string `json:"alipay_private_key"` // 应用私钥，RSA2
+	AlipayPublicKey            string `json:"alipay_public_key"`  // 支付宝公钥，用于响应验签
+	AlipayRedirectUrl          string `json:"alipay_redirect_url"`
+	TaobaoId                   string `json:"taobao_id"`
+	TaobaoSecret               string `json:"taobao_secret"`
+	TaobaoRedirectUrl          string `json:"taobao_redirect_url"`
+
+	OIDC   map[string]*OIDCConfig   `json:"oidc"`   // 通用OpenID Connect服务商配置，key为【NewServerByName】使用的名称
+	OAuth2 map[string]*OAuth2Config `json:"oauth2"` // 通用OAuth2服务商配置，key为【NewServerByName】使用的名称
 }
 
 type Userinfo struct {
-	Openid   string `json:"openid"`
-	UnionId  string `json:"unionId"`
-	NickName string `json:"nick_name"`
-	Avatar   string `json:"avatar"`
-	Mobile   string `json:"mobile"`
+	Openid        string         `json:"openid"`
+	UnionId       string         `json:"unionId"`
+	NickName      string         `json:"nick_name"`
+	Avatar        string         `json:"avatar"`
+	Mobile        string         `json:"mobile"`
+	Email         string         `json:"email"`
+	EmailVerified bool           `json:"email_verified"` // 服务商确认邮箱归属时为true
+	Username      string         `json:"username"`       // 登录名，如GitHub、码云的login
+	ProfileURL    string         `json:"profile_url"`    // 个人主页
+	Locale        string         `json:"locale"`
+	Provider      string         `json:"provider"` // 服务商注册名，由【Server】填充
+	Raw           map[string]any `json:"raw"`      // 服务商用户信息接口原始响应
 }
 
+// Ability 服务商实现，不带ctx的兼容方法由【Server】提供
 type Ability interface {
-	RedirectUrl() (string, error)
-	GetUserinfo(code string) (*Userinfo, error)
+	RedirectUrlContext(ctx context.Context, state *AuthState) (string, error)
+	GetUserinfoContext(ctx context.Context, code string, state *AuthState) (*Userinfo, error)
+}
+
+// TokenExchanger 服务商支持返回完整token，内置服务商均已实现
+type TokenExchanger interface {
+	ExchangeContext(ctx context.Context, code string, state *AuthState) (*Token, error)
+	GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error)
+}
+
+// Refresher 服务商支持使用refresh_token刷新token
+type Refresher interface {
+	RefreshContext(ctx context.Context, refreshToken string) (*Token, error)
+}
+
+// Revoker 服务商支持撤销授权，用户解绑账号时调用
+type Revoker interface {
+	RevokeContext(ctx context.Context, token string) error
+}
+
+// IDTokenVerifier 服务商支持校验OpenID Connect ID Token
+type IDTokenVerifier interface {
+	VerifyIDTokenContext(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error)
+}
+
+// PKCESupporter 服务商PKCE能力标识，未实现该接口的服务商视为不支持
+type PKCESupporter interface {
+	SupportPKCE() bool
+}
+
+// CallbackParser 服务商回调参数与通用格式不同时实现，未实现该接口的服务商使用【ParseCallbackValues】
+type CallbackParser interface {
+	ParseCallback(values url.Values) (*Callback, error)
 }
 
 type Server struct {
 	client      Ability
-	ImplementId int8 `json:"implement_id"`
+	ImplementId int8   `json:"implement_id"`
+	Provider    string `json:"provider"`
+	stateStore  StateStore
+	stateTTL    time.Duration
+	httpClient  *http.Client
+	retryPolicy RetryPolicy
+	breaker     breakerSetting
 }
 
-func Init(conf *Config) {
-	config = *conf
-	hasInit = true
+// breakerSetting 熔断配置，threshold小于等于0时不熔断
+type breakerSetting struct {
+	threshold   int
+	openTimeout time.Duration
 }
 
-func NewServer(implementId int8) (*Server, error) {
-	if !hasInit {
-		return nil, errors.New("配置未初始化,请先调用【Init】方法")
+type Option func(s *Server)
+
+// WithStateStore 指定state存储，默认使用进程内存储
+func WithStateStore(store StateStore) Option {
+	return func(s *Server) {
+		if store != nil {
+			s.stateStore = store
+		}
 	}
+}
 
-	var client Ability
-	switch implementId {
-	case ImplementGoogle:
-		if len(config.GoogleId) == 0 || len(config.GoogleSecret) == 0 || len(config.GoogleRedirectUrl) == 0 {
-			return nil, errors.New("缺失配置文件")
+// WithStateTTL 指定state有效期，默认【DefaultStateTTL】
+func WithStateTTL(ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl > 0 {
+			s.stateTTL = ttl
 		}
-		client = newGoogleServer()
-	case ImplementGithub:
-		if len(config.GithubId) == 0 || len(config.GithubSecret) == 0 || len(config.GithubRedirectUrl) == 0 {
-			return nil, errors.New("缺失配置文件")
+	}
+}
+
+// WithHttpClient 指定请求服务商使用的http客户端，可用于代理、自定义TLS、测试等场景
+func WithHttpClient(client *http.Client) Option {
+	return func(s *Server) {
+		if client != nil {
+			s.httpClient = client
 		}
-		client = newGithubServer()
-	case ImplementGitee:
-		if len(config.GiteeId) == 0 || len(config.GiteeSecret) == 0 || len(config.GiteeRedirectUrl) == 0 {
-			return nil, errors.New("缺失配置文件")
+	}
+}
+
+// WithTransport 指定请求服务商使用的RoundTripper，超时时间沿用默认值
+func WithTransport(transport http.RoundTripper) Option {
+	return func(s *Server) {
+		if transport != nil {
+			s.httpClient = newHttpClient(transport)
 		}
-		client = newGiteeServer()
-	case ImplementDingDing:
-		if len(config.DingDingId) == 0 || len(config.DingDingSecret) == 0 || len(config.DingDingRedirectUrl) == 0 {
-			return nil, errors.New("缺失配置文件")
+	}
+}
+
+// WithRetryPolicy 指定请求重试策略，默认【DefaultRetryPolicy】，MaxAttempts为1时不重试
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(s *Server) {
+		s.retryPolicy = policy
+	}
+}
+
+// WithCircuitBreaker 指定熔断配置，连续失败threshold次后openTimeout内直接返回【ErrProviderUnavailable】，threshold为0时不熔断
+func WithCircuitBreaker(threshold int, openTimeout time.Duration) Option {
+	return func(s *Server) {
+		s.breaker = breakerSetting{threshold: threshold, openTimeout: openTimeout}
+	}
+}
+
+// Client 持有独立配置的实例，同一进程内可创建多个使用不同凭证的实例
+type Client struct {
+	conf       Config
+	opts       []Option
+	stateStore StateStore // 默认state存储，实例间不共享，避免其他实例签发的state通过校验
+	breakersMu sync.Mutex
+	breakers   map[string]*circuitBreaker // 服务商注册名 => 熔断器，同一实例创建的同名服务共享
+}
+
+// circuitBreaker 获取服务商熔断器，首次创建时的配置生效
+func (c *Client) circuitBreaker(name string, setting breakerSetting) *circuitBreaker {
+	if setting.threshold <= 0 {
+		return nil
+	}
+
+	c.breakersMu.Lock()
+	defer c.breakersMu.Unlock()
+
+	if c.breakers == nil {
+		c.breakers = make(map[string]*circuitBreaker)
+	}
+	breaker, ok := c.breakers[name]
+	if !ok {
+		breaker = newCircuitBreaker(setting.threshold, setting.openTimeout)
+		c.breakers[name] = breaker
+	}
+
+	return breaker
+}
+
+// NewClient 创建实例，opts作用于该实例创建的所有服务
+func NewClient(conf *Config, opts ...Option) *Client {
+	client := &Client{opts: opts, stateStore: NewMemoryStateStore()}
+	if conf != nil {
+		client.conf = *conf
+	}
+
+	return client
+}
+
+// Init 注册默认实例配置，可并发调用，重复调用时后续【NewServer】使用新配置
+func Init(conf *Config) {
+	client := NewClient(conf)
+
+	defaultClientMu.Lock()
+	defer defaultClientMu.Unlock()
+	// 重新调用时沿用之前的state存储，已跳转授权的用户回调时仍可校验通过
+	if defaultClient != nil {
+		client.stateStore = defaultClient.stateStore
+	}
+	defaultClient = client
+}
+
+// NewServer 使用【Init】注册的默认实例创建服务
+func NewServer(implementId int8, opts ...Option) (*Server, error) {
+	defaultClientMu.RLock()
+	client := defaultClient
+	defaultClientMu.RUnlock()
+
+	if client == nil {
+		return nil, fmt.Errorf("%w:配置未初始化,请先调用【Init】方法", ErrNotConfigured)
+	}
+
+	return client.NewServer(implementId, opts...)
+}
+
+// NewServerByName 使用【Init】注册的默认实例，按注册名创建服务
+func NewServerByName(name string, opts ...Option) (*Server, error) {
+	defaultClientMu.RLock()
+	client := defaultClient
+	defaultClientMu.RUnlock()
+
+	if client == nil {
+		return nil, fmt.Errorf("%w:配置未初始化,请先调用【Init】方法", ErrNotConfigured)
+	}
+
+	return client.NewServerByName(name, opts...)
+}
+
+// NewServer 按内置服务商id创建服务，opts在实例opts之后生效
+func (c *Client) NewServer(implementId int8, opts ...Option) (*Server, error) {
+	name, err := lookupProviderName(implementId)
+	if err != nil {
+		return nil, err
+	}
+
+	return c.NewServerByName(name, opts...)
+}
+
+// NewServerByName 按注册名创建服务，包括通过【RegisterProvider】注册的自定义服务商；
+// 未注册的名称在Config.OIDC、Config.OAuth2中有同名配置时，直接使用通用OpenID Connect、OAuth2实现
+func (c *Client) NewServerByName(name string, opts ...Option) (*Server, error) {
+	factory, ok := lookupProvider(name)
+	if !ok {
+		if factory, ok = c.configuredProvider(name); !ok {
+			return nil, ErrUnknownProvider
 		}
-		client = newDingDingServer()
-	case ImplementFeiShu:
-		if len(config.FeiShuId) == 0 || len(config.FeiShuSecret) == 0 || len(config.FeiShuRedirectUrl) == 0 {
-			return nil, errors.New("缺失配置文件")
+	}
+
+	server := &Server{
+		ImplementId: providerImplementId(name),
+		Provider:    name,
+		stateStore:  c.stateStore,
+		stateTTL:    DefaultStateTTL,
+		httpClient:  defaultHttpClient,
+		retryPolicy: DefaultRetryPolicy,
+		breaker:     breakerSetting{threshold: DefaultBreakerThreshold, openTimeout: DefaultBreakerOpenTimeout},
+	}
+	for _, opt := range c.opts {
+		opt(server)
+	}
+	for _, opt := range opts {
+		opt(server)
+	}
+
+	client, err := factory(ProviderConfig{
+		Name:        name,
+		ImplementId: server.ImplementId,
+		Config:      &c.conf,
+		HttpClient:  newResilientClient(server.httpClient, server.retryPolicy, c.circuitBreaker(name, server.breaker)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if client == nil {
+		return nil, errors.New("服务商【" + name + "】实现为空")
+	}
+	server.client = client
+
+	return server, nil
+}
+
+// configuredProvider 按配置匹配通用服务商实现，OIDC优先
+func (c *Client) configuredProvider(name string) (ProviderFactory, bool) {
+	if c.conf.OIDC[name] != nil {
+		return OIDCProvider, true
+	}
+	if c.conf.OAuth2[name] != nil {
+		return OAuth2Provider, true
+	}
+
+	return nil, false
+}
+
+// RedirectOption 单次授权跳转的参数，随state一起保存
+type RedirectOption func(state *AuthState)
+
+// RedirectUrl 获取web登录跳转地址，同时返回本次签发的state
+func (s *Server) RedirectUrl(opts ...RedirectOption) (redirectUrl string, state string, err error) {
+	return s.RedirectUrlContext(context.Background(), opts...)
+}
+
+func (s *Server) RedirectUrlContext(ctx context.Context, opts ...RedirectOption) (redirectUrl string, state string, err error) {
+	authState := &AuthState{
+		State:       rand32Str(),
+		ImplementId: s.ImplementId,
+		Provider:    s.Provider,
+		Nonce:       rand32Str(),
+	}
+	for _, opt := range opts {
+		opt(authState)
+	}
+	if s.supportPKCE() {
+		if authState.CodeVerifier, err = newCodeVerifier(); err != nil {
+			return "", "", fmt.Errorf("code_verifier生成失败:%w", err)
 		}
-		client = newFeiShuServer()
-	default:
-		return nil, errors.New("未定义实现")
 	}
 
-	return &Server{
-		client:      client,
-		ImplementId: implementId,
-	}, nil
+	// 授权地址生成成功后再保存state，避免失败时残留无用的state
+	redirectUrl, err = s.client.RedirectUrlContext(ctx, authState)
+	if err != nil {
+		return "", "", s.wrapError(StageAuthorize, err)
+	}
+	if err = s.stateStore.Save(authState, s.stateTTL); err != nil {
+		return "", "", fmt.Errorf("state保存失败:%w", err)
+	}
+
+	return redirectUrl, authState.State, nil
+}
+
+// takeState 取出并校验回调中的state，state只能使用一次
+func (s *Server) takeState(state string) (*AuthState, error) {
+	if len(state) == 0 {
+		return nil, ErrInvalidState
+	}
+
+	authState, err := s.stateStore.Take(state)
+	if err != nil {
+		return nil, err
+	}
+	if authState.expired() || authState.Provider != s.Provider {
+		return nil, ErrInvalidState
+	}
+
+	return authState, nil
+}
+
+// Login 校验回调中的state后使用code换取账户信息
+func (s *Server) Login(code, state string) (*Userinfo, error) {
+	return s.LoginContext(context.Background(), code, state)
+}
+
+func (s *Server) LoginContext(ctx context.Context, code, state string) (*Userinfo, error) {
+	authState, err := s.takeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.login(ctx, code, authState)
+}
+
+// login 支持【TokenExchanger】的服务商分别换取token及账户信息，以便错误中携带准确的出错阶段；
+// code只能使用一次，换取token的请求标记为不可重复提交，不支持【TokenExchanger】的服务商整个流程均不重试
+func (s *Server) login(ctx context.Context, code string, authState *AuthState) (*Userinfo, error) {
+	exchanger, ok := s.client.(TokenExchanger)
+	if !ok {
+		userinfo, err := s.client.GetUserinfoContext(withNonIdempotent(ctx), code, authState)
+		return s.checkUserinfo(userinfo, err)
+	}
+
+	token, err := exchanger.ExchangeContext(withNonIdempotent(ctx), code, authState)
+	if token, err = s.checkToken(StageExchange, token, err); err != nil {
+		return nil, err
+	}
+
+	return s.checkUserinfo(exchanger.GetUserinfoWithTokenContext(ctx, token))
+}
+
+// Exchange 校验回调中的state后使用code换取完整token，需要后续代用户调用服务商接口时使用
+func (s *Server) Exchange(code, state string) (*Token, error) {
+	return s.ExchangeContext(context.Background(), code, state)
+}
+
+func (s *Server) ExchangeContext(ctx context.Context, code, state string) (*Token, error) {
+	exchanger, ok := s.client.(TokenExchanger)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	authState, err := s.takeState(state)
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := exchanger.ExchangeContext(withNonIdempotent(ctx), code, authState)
+	return s.checkToken(StageExchange, token, err)
+}
+
+// GetUserinfoWithToken 使用【Exchange】获取的token换取账户信息
+func (s *Server) GetUserinfoWithToken(token *Token) (*Userinfo, error) {
+	return s.GetUserinfoWithTokenContext(context.Background(), token)
 }
 
-func (s *Server) RedirectUrl() (string, error) {
-	return s.client.RedirectUrl()
+func (s *Server) GetUserinfoWithTokenContext(ctx context.Context, token *Token) (*Userinfo, error) {
+	exchanger, ok := s.client.(TokenExchanger)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if token == nil || len(token.AccessToken) == 0 {
+		return nil, errors.New("token不能为空")
+	}
+
+	return s.checkUserinfo(exchanger.GetUserinfoWithTokenContext(ctx, token))
 }
 
+// GetUserinfo 使用code换取账户信息，不校验state，推荐使用【Login】；
+// 启用PKCE的服务商（谷歌、GitHub、Gitee、飞书等）code_verifier随state保存，此方法无法发送，直接返回【ErrNotSupported】
 func (s *Server) GetUserinfo(code string) (*Userinfo, error) {
-	return s.client.GetUserinfo(code)
+	return s.GetUserinfoContext(context.Background(), code)
+}
+
+func (s *Server) GetUserinfoContext(ctx context.Context, code string) (*Userinfo, error) {
+	if s.supportPKCE() {
+		return nil, fmt.Errorf("%w:服务商启用PKCE，请使用Login校验state并发送code_verifier", ErrNotSupported)
+	}
+
+	return s.login(ctx, code, nil)
+}
+
+// supportPKCE 服务商是否在授权时使用PKCE
+func (s *Server) supportPKCE() bool {
+	supporter, ok := s.client.(PKCESupporter)
+	return ok && supporter.SupportPKCE()
+}
+
+// checkToken 包装换取、刷新token的错误，未返回access_token视为失败
+func (s *Server) checkToken(stage string, token *Token, err error) (*Token, error) {
+	if err != nil {
+		return nil, s.wrapError(stage, err)
+	}
+	if token == nil || len(token.AccessToken) == 0 {
+		return nil, s.wrapError(stage, invalidResponse("token响应缺失access_token"))
+	}
+
+	return token, nil
+}
+
+// checkUserinfo 包装获取账户信息的错误，openid为空视为失败，成功时填充所属服务商
+func (s *Server) checkUserinfo(userinfo *Userinfo, err error) (*Userinfo, error) {
+	if err != nil {
+		return nil, s.wrapError(StageUserinfo, err)
+	}
+	if userinfo == nil || len(userinfo.Openid) == 0 {
+		return nil, s.wrapError(StageUserinfo, invalidResponse("账户信息缺失openid"))
+	}
+	userinfo.Provider = s.Provider
+
+	return userinfo, nil
+}
+
+// wrapError 统一包装为【ProviderError】，补充服务商、出错阶段及错误分类；
+// 底层错误中的【ProviderError】不会被修改，外层补充的上下文通过Err保留
+func (s *Server) wrapError(stage string, err error) error {
+	wrapped := &ProviderError{Provider: s.Provider, Stage: stage, Err: err}
+
+	var providerErr *ProviderError
+	if !errors.As(err, &providerErr) {
+		wrapped.Kind = classifyCause(err)
+		return wrapped
+	}
+
+	wrapped.HTTPStatus, wrapped.Code, wrapped.Description, wrapped.Kind = providerErr.HTTPStatus, providerErr.Code, providerErr.Description, providerErr.Kind
+	if len(providerErr.Provider) > 0 {
+		wrapped.Provider = providerErr.Provider
+	}
+	if len(providerErr.Stage) > 0 {
+		wrapped.Stage = providerErr.Stage
+	}
+	// 未经包装的服务商错误直接复制，无需保留自身
+	if providerErr == err {
+		wrapped.Err = providerErr.Err
+	}
+	if wrapped.Kind == nil {
+		wrapped.Kind = classifyProviderError(wrapped.Provider, wrapped.Stage, wrapped)
+	}
+
+	return wrapped
+}
+
+// CanRefresh 服务商是否支持刷新token
+func (s *Server) CanRefresh() bool {
+	_, ok := s.client.(Refresher)
+	return ok
+}
+
+// Refresh 使用refresh_token刷新token，服务商不支持时返回【ErrNotSupported】
+func (s *Server) Refresh(refreshToken string) (*Token, error) {
+	return s.RefreshContext(context.Background(), refreshToken)
+}
+
+func (s *Server) RefreshContext(ctx context.Context, refreshToken string) (*Token, error) {
+	refresher, ok := s.client.(Refresher)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+	if len(refreshToken) == 0 {
+		return nil, errors.New("refresh_token不能为空")
+	}
+
+	token, err := refresher.RefreshContext(withNonIdempotent(ctx), refreshToken)
+	if token, err = s.checkToken(StageRefresh, token, err); err != nil {
+		return nil, err
+	}
+
+	// 谷歌等服务商刷新时不返回新的refresh_token，原refresh_token继续有效
+	if len(token.RefreshToken) == 0 {
+		token.RefreshToken = refreshToken
+	}
+
+	return token, nil
+}
+
+// CanRevoke 服务商是否支持撤销授权
+func (s *Server) CanRevoke() bool {
+	_, ok := s.client.(Revoker)
+	return ok
+}
+
+// Revoke 撤销用户授权，token为access_token（谷歌也可传refresh_token），服务商不支持时返回【ErrNotSupported】
+func (s *Server) Revoke(token string) error {
+	return s.RevokeContext(context.Background(), token)
+}
+
+func (s *Server) RevokeContext(ctx context.Context, token string) error {
+	revoker, ok := s.client.(Revoker)
+	if !ok {
+		return ErrNotSupported
+	}
+	if len(token) == 0 {
+		return errors.New("token不能为空")
+	}
+
+	if err := revoker.RevokeContext(ctx, token); err != nil {
+		return s.wrapError(StageRevoke, err)
+	}
+
+	return nil
+}
+
+// VerifyIDToken 校验前端直接获取的id_token（如谷歌One Tap），nonce为空时不校验nonce
+func (s *Server) VerifyIDToken(idToken, nonce string) (*IDTokenClaims, error) {
+	return s.VerifyIDTokenContext(context.Background(), idToken, nonce)
+}
+
+func (s *Server) VerifyIDTokenContext(ctx context.Context, idToken, nonce string) (*IDTokenClaims, error) {
+	verifier, ok := s.client.(IDTokenVerifier)
+	if !ok {
+		return nil, ErrNotSupported
+	}
+
+	claims, err := verifier.VerifyIDTokenContext(ctx, idToken, nonce)
+	if err != nil {
+		return nil, s.wrapError(StageVerify, err)
+	}
+
+	return claims, nil
 }
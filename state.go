@@ -0,0 +1,134 @@
+package pkg_login
+
+import (
+	"container/list"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultStateTTL = time.Minute * 10 // state默认有效期
+	stateGCInterval = time.Minute      // 内存state过期清理间隔
+
+	DefaultMaxStates = 100000 // 内存state存储默认容量
+)
+
+// AuthState 一次授权流程中需要服务端暂存的数据，由【RedirectUrl】签发，回调时校验
+type AuthState struct {
+	State        string    `json:"state"`
+	ImplementId  int8      `json:"implement_id"`
+	Provider     string    `json:"provider"`
+	CodeVerifier string    `json:"code_verifier"` // PKCE code_verifier，服务商不支持PKCE时为空
+	Nonce        string    `json:"nonce"`         // OpenID Connect nonce，用于校验id_token
+	Scope        string    `json:"scope"`         // 本次授权的scope，为空时使用配置，目前仅微信公众号支持
+	ExpireAt     time.Time `json:"expire_at"`
+}
+
+func (a *AuthState) expired() bool {
+	return !a.ExpireAt.IsZero() && time.Now().After(a.ExpireAt)
+}
+
+// StateStore state存储，默认使用进程内存储，多实例部署时可替换为redis等共享存储
+type StateStore interface {
+	// Save 保存state，ttl后失效
+	Save(state *AuthState, ttl time.Duration) error
+	// Take 取出并删除state，state不存在或已过期时返回【ErrInvalidState】
+	Take(state string) (*AuthState, error)
+}
+
+// MemoryStateStore 进程内state存储，state数量达到容量上限时淘汰最早签发的state，过期state每分钟清理一次；
+// 大量匿名请求登录地址时只会使较早签发、尚未回调的state失效，不会拒绝新的登录
+type MemoryStateStore struct {
+	mu        sync.Mutex
+	states    map[string]*list.Element
+	order     *list.List // 按签发顺序排列的*AuthState，最早签发的在前
+	maxStates int
+	lastGC    time.Time
+}
+
+// NewMemoryStateStore 创建容量为【DefaultMaxStates】的进程内state存储
+func NewMemoryStateStore() *MemoryStateStore {
+	return NewMemoryStateStoreWithLimit(DefaultMaxStates)
+}
+
+// NewMemoryStateStoreWithLimit 创建指定容量的进程内state存储，maxStates小于等于0时使用【DefaultMaxStates】
+func NewMemoryStateStoreWithLimit(maxStates int) *MemoryStateStore {
+	if maxStates <= 0 {
+		maxStates = DefaultMaxStates
+	}
+
+	return &MemoryStateStore{
+		states:    make(map[string]*list.Element),
+		order:     list.New(),
+		maxStates: maxStates,
+		lastGC:    time.Now(),
+	}
+}
+
+func (m *MemoryStateStore) Save(state *AuthState, ttl time.Duration) error {
+	if state == nil || len(state.State) == 0 {
+		return errors.New("state不能为空")
+	}
+
+	saved := *state
+	if ttl > 0 {
+		saved.ExpireAt = time.Now().Add(ttl)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.gc()
+	if elem, ok := m.states[saved.State]; ok {
+		m.remove(elem)
+	}
+	for len(m.states) >= m.maxStates {
+		m.remove(m.order.Front())
+	}
+	m.states[saved.State] = m.order.PushBack(&saved)
+
+	return nil
+}
+
+func (m *MemoryStateStore) Take(state string) (*AuthState, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	elem, ok := m.states[state]
+	if !ok {
+		return nil, ErrInvalidState
+	}
+	saved := m.remove(elem)
+
+	if saved.expired() {
+		return nil, ErrInvalidState
+	}
+
+	return saved, nil
+}
+
+// gc 清理已过期的state，调用方需持有锁
+func (m *MemoryStateStore) gc() {
+	now := time.Now()
+	if now.Sub(m.lastGC) < stateGCInterval {
+		return
+	}
+	m.lastGC = now
+
+	for elem := m.order.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*AuthState).expired() {
+			m.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// remove 删除state，调用方需持有锁
+func (m *MemoryStateStore) remove(elem *list.Element) *AuthState {
+	state := m.order.Remove(elem).(*AuthState)
+	delete(m.states, state.State)
+
+	return state
+}
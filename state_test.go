@@ -0,0 +1,190 @@
+package pkg_login
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestMemoryStateStoreTakeOnce(t *testing.T) {
+	store := NewMemoryStateStore()
+	if err := store.Save(&AuthState{State: "s1", Provider: ProviderGithub, CodeVerifier: "verifier"}, time.Minute); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+
+	saved, err := store.Take("s1")
+	if err != nil {
+		t.Fatalf("取出失败: %v", err)
+	}
+	if saved.Provider != ProviderGithub || saved.CodeVerifier != "verifier" || saved.ExpireAt.IsZero() {
+		t.Fatalf("state内容错误: %+v", saved)
+	}
+
+	if _, err := store.Take("s1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("重复使用期望ErrInvalidState，实际: %v", err)
+	}
+	if _, err := store.Take("unknown"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("不存在的state期望ErrInvalidState，实际: %v", err)
+	}
+}
+
+func TestMemoryStateStoreExpired(t *testing.T) {
+	store := NewMemoryStateStore()
+	if err := store.Save(&AuthState{State: "s1"}, time.Millisecond); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	time.Sleep(time.Millisecond * 5)
+
+	if _, err := store.Take("s1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("过期state期望ErrInvalidState，实际: %v", err)
+	}
+}
+
+func TestMemoryStateStoreSaveCopy(t *testing.T) {
+	store := NewMemoryStateStore()
+	state := &AuthState{State: "s1", Nonce: "n1"}
+	if err := store.Save(state, time.Minute); err != nil {
+		t.Fatalf("保存失败: %v", err)
+	}
+	state.Nonce = "changed"
+
+	saved, err := store.Take("s1")
+	if err != nil {
+		t.Fatalf("取出失败: %v", err)
+	}
+	if saved.Nonce != "n1" {
+		t.Fatalf("保存后修改原state不应影响存储，实际nonce: %s", saved.Nonce)
+	}
+
+	if err := store.Save(&AuthState{}, time.Minute); err == nil {
+		t.Fatal("空state期望保存失败")
+	}
+}
+
+func TestMemoryStateStoreLimit(t *testing.T) {
+	store := NewMemoryStateStoreWithLimit(2)
+	for _, state := range []string{"s1", "s2", "s3"} {
+		if err := store.Save(&AuthState{State: state}, time.Minute); err != nil {
+			t.Fatalf("保存失败: %v", err)
+		}
+	}
+
+	// 超出容量时淘汰最早签发的state，新的state正常签发
+	if _, err := store.Take("s1"); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("被淘汰的state期望ErrInvalidState，实际: %v", err)
+	}
+	for _, state := range []string{"s2", "s3"} {
+		if _, err := store.Take(state); err != nil {
+			t.Fatalf("取出%s失败: %v", state, err)
+		}
+	}
+	if len(store.states) != 0 || store.order.Len() != 0 {
+		t.Fatalf("取出后应释放容量，实际%d个", len(store.states))
+	}
+}
+
+func TestServerTakeState(t *testing.T) {
+	client := NewClient(&Config{
+		GithubId: "github_id", GithubSecret: "github_secret", GithubRedirectUrl: "https://example.com/callback",
+		GiteeId: "gitee_id", GiteeSecret: "gitee_secret", GiteeRedirectUrl: "https://example.com/callback",
+	}, WithStateStore(NewMemoryStateStore()))
+	github, err := client.NewServer(ImplementGithub)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	gitee, err := client.NewServer(ImplementGitee)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+
+	t.Run("服务商不匹配", func(t *testing.T) {
+		_, state, err := github.RedirectUrl()
+		if err != nil {
+			t.Fatalf("生成授权地址失败: %v", err)
+		}
+		if _, err := gitee.Login("code", state); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("期望ErrInvalidState，实际: %v", err)
+		}
+		// 不匹配时state同样被消耗，不能再用于原服务商
+		if _, err := github.Login("code", state); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("期望ErrInvalidState，实际: %v", err)
+		}
+	})
+
+	t.Run("state签发与取出", func(t *testing.T) {
+		_, state, err := github.RedirectUrl()
+		if err != nil {
+			t.Fatalf("生成授权地址失败: %v", err)
+		}
+		authState, err := github.takeState(state)
+		if err != nil {
+			t.Fatalf("取出state失败: %v", err)
+		}
+		if authState.Provider != ProviderGithub || len(authState.CodeVerifier) == 0 || len(authState.Nonce) == 0 {
+			t.Fatalf("state内容错误: %+v", authState)
+		}
+		if _, err := github.takeState(state); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("重复使用期望ErrInvalidState，实际: %v", err)
+		}
+	})
+
+	t.Run("state过期", func(t *testing.T) {
+		expiring, err := client.NewServer(ImplementGithub, WithStateTTL(time.Millisecond))
+		if err != nil {
+			t.Fatalf("创建服务失败: %v", err)
+		}
+		_, state, err := expiring.RedirectUrl()
+		if err != nil {
+			t.Fatalf("生成授权地址失败: %v", err)
+		}
+		time.Sleep(time.Millisecond * 5)
+
+		if _, err := expiring.Login("code", state); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("期望ErrInvalidState，实际: %v", err)
+		}
+	})
+
+	t.Run("state为空", func(t *testing.T) {
+		if _, err := github.Login("code", ""); !errors.Is(err, ErrInvalidState) {
+			t.Fatalf("期望ErrInvalidState，实际: %v", err)
+		}
+	})
+}
+
+func TestServerRedirectUrlFailureSavesNoState(t *testing.T) {
+	store := NewMemoryStateStoreWithLimit(1)
+	server, err := NewClient(NewWeiXinMpConf("mp_id", "mp_secret", "https://example.com/callback", ""), WithStateStore(store)).NewServer(ImplementWeiXinMp)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+
+	if _, _, err := server.RedirectUrl(WithWeiXinMpScope("invalid")); err == nil {
+		t.Fatal("无效scope期望生成授权地址失败")
+	}
+	if len(store.states) != 0 {
+		t.Fatalf("生成授权地址失败时不应保存state，实际%d个", len(store.states))
+	}
+}
+
+func TestClientStateIsolation(t *testing.T) {
+	conf := NewGithubConf("github_id", "github_secret", "https://a.example.com/callback")
+	serverA, err := NewClient(conf).NewServer(ImplementGithub)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+	serverB, err := NewClient(NewGithubConf("other_id", "other_secret", "https://b.example.com/callback")).NewServer(ImplementGithub)
+	if err != nil {
+		t.Fatalf("创建服务失败: %v", err)
+	}
+
+	_, state, err := serverA.RedirectUrl()
+	if err != nil {
+		t.Fatalf("生成授权地址失败: %v", err)
+	}
+	if _, err := serverB.takeState(state); !errors.Is(err, ErrInvalidState) {
+		t.Fatalf("其他实例签发的state期望ErrInvalidState，实际: %v", err)
+	}
+	if _, err := serverA.takeState(state); err != nil {
+		t.Fatalf("本实例签发的state校验失败: %v", err)
+	}
+}
@@ -0,0 +1,70 @@
+package pkg_login
+
+import (
+	"encoding/json"
+	"maps"
+	"strings"
+	"time"
+)
+
+// Token code换取的完整token信息，不同服务商返回字段不同，未返回的字段为零值
+type Token struct {
+	AccessToken  string         `json:"access_token"`
+	RefreshToken string         `json:"refresh_token"`
+	TokenType    string         `json:"token_type"`
+	Expiry       time.Time      `json:"expiry"` // access_token过期时间，零值表示服务商未返回有效期
+	Scopes       []string       `json:"scopes"` // 实际授予的权限
+	IDToken      string         `json:"id_token"`
+	Claims       *IDTokenClaims `json:"claims"` // 换取或刷新时已校验的id_token声明，未返回id_token时为nil；仅供读取，获取账户信息时会重新校验IDToken
+	Raw          map[string]any `json:"raw"`    // 服务商原始响应，数字以json.Number保存
+}
+
+// Expired access_token是否已过期，未返回有效期时视为未过期
+func (t *Token) Expired() bool {
+	return !t.Expiry.IsZero() && time.Now().After(t.Expiry)
+}
+
+// rawString 读取原始响应中的字符串或数字字段
+func (t *Token) rawString(key string) string {
+	if t == nil {
+		return ""
+	}
+
+	switch val := t.Raw[key].(type) {
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	default:
+		return ""
+	}
+}
+
+// tokenSecretKeys 原始响应中的凭证及有效期字段，不能随账户信息返回
+var tokenSecretKeys = []string{"access_token", "refresh_token", "expires_in", "re_expires_in"}
+
+// userinfoRaw 复制原始响应并去掉凭证字段，用于token响应中即包含账户信息的服务商填充【Userinfo.Raw】
+func (t *Token) userinfoRaw() map[string]any {
+	raw := maps.Clone(t.Raw)
+	for _, key := range tokenSecretKeys {
+		delete(raw, key)
+	}
+
+	return raw
+}
+
+// expiryIn 根据有效期秒数计算过期时间
+func expiryIn(seconds int64) time.Time {
+	if seconds <= 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(seconds) * time.Second)
+}
+
+// splitScopes 兼容空格及逗号分隔的scope
+func splitScopes(scope string) []string {
+	return strings.FieldsFunc(scope, func(r rune) bool {
+		return r == ' ' || r == ','
+	})
+}
@@ -0,0 +1,30 @@
+package pkg_login
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTokenUserinfoRaw(t *testing.T) {
+	token := &Token{Raw: map[string]any{
+		"access_token":     "access",
+		"refresh_token":    "refresh",
+		"expires_in":       json.Number("7200"),
+		"re_expires_in":    json.Number("2592000"),
+		"openid":           "openid",
+		"taobao_user_nick": "nick",
+	}}
+
+	raw := token.userinfoRaw()
+	for _, key := range tokenSecretKeys {
+		if _, ok := raw[key]; ok {
+			t.Fatalf("Raw不应包含%s", key)
+		}
+	}
+	if raw["openid"] != "openid" || raw["taobao_user_nick"] != "nick" {
+		t.Fatalf("账户字段丢失: %v", raw)
+	}
+	if token.rawString("access_token") != "access" {
+		t.Fatal("不应修改token原始响应")
+	}
+}
@@ -1,17 +1,47 @@
 package pkg_login
 
 import (
+	"bytes"
+	"context"
 	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"encoding/json"
 	"github.com/google/uuid"
+	"io"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 )
 
-func postBase(url string, payload string, headers map[string]string) (resp *http.Response, err error) {
-	client := &http.Client{Timeout: time.Second * 5}
-	req, err := http.NewRequest("POST", url, strings.NewReader(payload))
+const (
+	defaultHttpTimeout  = time.Second * 5 // 默认请求超时时间
+	maxResponseBodySize = 1 << 20         // 响应体最大读取字节数
+	responseSnippetSize = 256             // 错误中保留的非json响应片段长度
+)
+
+// defaultHttpClient 所有服务共享的默认http客户端，复用连接池
+var defaultHttpClient = newHttpClient(newDefaultTransport())
+
+func newDefaultTransport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.MaxIdleConns = 100
+	transport.MaxIdleConnsPerHost = 10
+	transport.IdleConnTimeout = time.Second * 90
+
+	return transport
+}
+
+func newHttpClient(transport http.RoundTripper) *http.Client {
+	return &http.Client{Timeout: defaultHttpTimeout, Transport: transport}
+}
+
+func postBase(ctx context.Context, client *http.Client, url string, payload string, headers map[string]string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(payload))
 	if err != nil {
 		return
 	}
@@ -22,9 +52,8 @@ func postBase(url string, payload string, headers map[string]string) (resp *http
 	return client.Do(req)
 }
 
-func getBase(requestUrl string, headers map[string]string) (resp *http.Response, err error) {
-	client := &http.Client{Timeout: time.Second * 5}
-	req, err := http.NewRequest("GET", requestUrl, nil)
+func getBase(ctx context.Context, client *http.Client, requestUrl string, headers map[string]string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", requestUrl, nil)
 	if err != nil {
 		return
 	}
@@ -34,6 +63,133 @@ func getBase(requestUrl string, headers map[string]string) (resp *http.Response,
 	return client.Do(req)
 }
 
+func deleteBase(ctx context.Context, client *http.Client, url string, payload string, headers map[string]string) (resp *http.Response, err error) {
+	req, err := http.NewRequestWithContext(ctx, "DELETE", url, strings.NewReader(payload))
+	if err != nil {
+		return
+	}
+	for index, val := range headers {
+		req.Header.Set(index, val)
+	}
+
+	return client.Do(req)
+}
+
+// readBody 读取响应体，超过maxResponseBodySize时返回错误
+func readBody(response *http.Response) ([]byte, error) {
+	content, err := io.ReadAll(io.LimitReader(response.Body, maxResponseBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(content) > maxResponseBodySize {
+		return nil, &ProviderError{
+			HTTPStatus:  response.StatusCode,
+			Description: "响应超过" + strconv.Itoa(maxResponseBodySize) + "字节",
+			Kind:        ErrInvalidResponse,
+		}
+	}
+
+	return content, nil
+}
+
+// readResponse 读取json响应体，非json响应（如网关返回的html错误页）及非2xx状态码返回【ProviderError】
+func readResponse(response *http.Response) ([]byte, error) {
+	content, err := readBody(response)
+	if err != nil {
+		return nil, err
+	}
+
+	success := response.StatusCode >= 200 && response.StatusCode < 300
+	if !json.Valid(content) {
+		providerErr := &ProviderError{HTTPStatus: response.StatusCode, Description: "非json响应:" + bodySnippet(content)}
+		if success {
+			providerErr.Kind = ErrInvalidResponse
+		}
+		return nil, providerErr
+	}
+	if !success {
+		return nil, statusError(response.StatusCode, content)
+	}
+
+	return content, nil
+}
+
+// decodeResponse 读取并解析json响应到v，同时返回原始字段，状态码处理见【readResponse】
+func decodeResponse(response *http.Response, v any) (map[string]any, error) {
+	content, err := readResponse(response)
+	if err != nil {
+		return nil, err
+	}
+
+	return decodeJSON(bytes.NewReader(content), v)
+}
+
+// statusError 非2xx的json响应，从常见错误字段中提取错误码及描述
+func statusError(httpStatus int, content []byte) *ProviderError {
+	providerErr := &ProviderError{HTTPStatus: httpStatus}
+
+	raw := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		providerErr.Description = bodySnippet(content)
+		return providerErr
+	}
+	// 谷歌等服务商错误信息嵌套在error对象中
+	if nested, ok := raw["error"].(map[string]any); ok {
+		raw = nested
+	}
+
+	for _, key := range []string{"error", "errcode", "error_code", "status", "code"} {
+		if providerErr.Code = lookupString(raw, key); len(providerErr.Code) > 0 {
+			break
+		}
+	}
+	for _, key := range []string{"error_description", "errmsg", "message", "msg"} {
+		if providerErr.Description = lookupString(raw, key); len(providerErr.Description) > 0 {
+			break
+		}
+	}
+	if len(providerErr.Code) == 0 && len(providerErr.Description) == 0 {
+		providerErr.Description = bodySnippet(content)
+	}
+
+	return providerErr
+}
+
+// bodySnippet 截取响应片段用于错误信息
+func bodySnippet(content []byte) string {
+	snippet := strings.TrimSpace(strings.ToValidUTF8(string(content[:min(len(content), responseSnippetSize)]), ""))
+	if len(content) > responseSnippetSize {
+		snippet += "..."
+	}
+
+	return snippet
+}
+
+// decodeJSON 解析json响应到v，同时返回原始字段，v为nil时只返回原始字段
+func decodeJSON(body io.Reader, v any) (map[string]any, error) {
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return nil, err
+	}
+
+	if v != nil {
+		if err := json.Unmarshal(content, v); err != nil {
+			return nil, err
+		}
+	}
+
+	raw := make(map[string]any)
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	return raw, nil
+}
+
 func rand32Str() string {
 	harsher := md5.New()
 	harsher.Write([]byte(uuid.New().String()))
@@ -45,3 +201,79 @@ func rand32Str() string {
 
 	return hashStr
 }
+
+// newCodeVerifier 生成PKCE code_verifier（RFC 7636 4.1）
+func newCodeVerifier() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// codeChallengeS256 根据code_verifier计算S256 code_challenge（RFC 7636 4.2）
+func codeChallengeS256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// addCodeChallenge 存在code_verifier时向授权地址追加PKCE参数
+func addCodeChallenge(queryParams url.Values, state *AuthState) {
+	if state == nil || len(state.CodeVerifier) == 0 {
+		return
+	}
+	queryParams.Add("code_challenge", codeChallengeS256(state.CodeVerifier))
+	queryParams.Add("code_challenge_method", "S256")
+}
+
+// addCodeVerifier 存在code_verifier时向token请求追加PKCE参数
+func addCodeVerifier(formData url.Values, state *AuthState) {
+	if state == nil || len(state.CodeVerifier) == 0 {
+		return
+	}
+	formData.Set("code_verifier", state.CodeVerifier)
+}
+
+// lookupPath 按.分隔的路径读取字段，数组使用下标
+func lookupPath(raw map[string]any, path string) any {
+	if len(path) == 0 {
+		return nil
+	}
+
+	var current any = raw
+	for _, key := range strings.Split(path, ".") {
+		switch node := current.(type) {
+		case map[string]any:
+			current = node[key]
+		case []any:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil
+			}
+			current = node[index]
+		default:
+			return nil
+		}
+	}
+
+	return current
+}
+
+// lookupString 按路径读取字段并转换为字符串，对象及数组返回json原文
+func lookupString(raw map[string]any, path string) string {
+	switch val := lookupPath(raw, path).(type) {
+	case nil:
+		return ""
+	case string:
+		return val
+	case json.Number:
+		return val.String()
+	case bool:
+		return strconv.FormatBool(val)
+	default:
+		buf := &bytes.Buffer{}
+		_ = json.NewEncoder(buf).Encode(val)
+		return strings.TrimSpace(buf.String())
+	}
+}
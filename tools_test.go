@@ -0,0 +1,53 @@
+package pkg_login
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestLookupPath(t *testing.T) {
+	raw := map[string]any{}
+	decoder := json.NewDecoder(strings.NewReader(`{
+		"code": 0,
+		"ok": true,
+		"data": {
+			"user": {"id": 10001, "name": "user", "tags": ["a", "b"]},
+			"list": [{"id": "first"}, {"id": "second"}]
+		}
+	}`))
+	decoder.UseNumber()
+	if err := decoder.Decode(&raw); err != nil {
+		t.Fatalf("解析失败: %v", err)
+	}
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "", want: ""},
+		{path: "code", want: "0"},
+		{path: "ok", want: "true"},
+		{path: "data.user.id", want: "10001"},
+		{path: "data.user.name", want: "user"},
+		{path: "data.user.tags", want: `["a","b"]`},
+		{path: "data.user.tags.1", want: "b"},
+		{path: "data.list.0.id", want: "first"},
+		{path: "data.user", want: `{"id":10001,"name":"user","tags":["a","b"]}`},
+		{path: "data.list.2.id", want: ""},
+		{path: "data.list.-1.id", want: ""},
+		{path: "data.list.first", want: ""},
+		{path: "data.user.name.first", want: ""},
+		{path: "missing.id", want: ""},
+	}
+
+	for _, tt := range tests {
+		if got := lookupString(raw, tt.path); got != tt.want {
+			t.Errorf("lookupString(%q) = %q，期望 %q", tt.path, got, tt.want)
+		}
+	}
+
+	if lookupPath(raw, "data.list.2") != nil || lookupPath(nil, "code") != nil {
+		t.Error("不存在的路径期望返回nil")
+	}
+}